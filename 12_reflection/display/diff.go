@@ -0,0 +1,311 @@
+package display
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+
+	"gopl.io/ch12/format"
+)
+
+// A Difference is a leaf at which two values diverge, named by its
+// path as Display would print it, with the value on either side.
+type Difference struct {
+	Path   string `json:"path"`
+	Change Change `json:"change"`
+	Old    string `json:"old,omitempty"` // absent if Added
+	New    string `json:"new,omitempty"` // absent if Removed
+}
+
+// A Change says how a leaf differs.
+type Change string
+
+const (
+	Added   Change = "added"   // only in the second value
+	Removed Change = "removed" // only in the first value
+	Changed Change = "changed" // in both, with different values
+)
+
+// Diff walks a and b together and returns the leaves at which they
+// differ, with paths rooted at x, as in (*x).Actor["Gen. Buck Turgidson"].
+// An element, map entry or pointee present on one side only gives a
+// Removed or Added difference for each of its leaves. Values of
+// different types differ as a whole. Unexported fields are compared
+// too, since they may be all that differs, as for time.Time; and map
+// keys are visited in sorted order, so the result is deterministic.
+// Pointers, maps and slices already compared are not compared again,
+// so Diff terminates on cyclic values.
+func Diff(a, b interface{}) []Difference {
+	d := &differ{seen: make(map[[2]ref]bool)}
+	d.diff("x", reflect.ValueOf(a), reflect.ValueOf(b))
+	return d.diffs
+}
+
+// A differ holds the state of a single call to Diff.
+type differ struct {
+	diffs []Difference
+	seen  map[[2]ref]bool // pairs of references already compared
+}
+
+func (d *differ) diff(path string, a, b reflect.Value) {
+	if !a.IsValid() || !b.IsValid() {
+		if a.IsValid() || b.IsValid() {
+			d.changed(path, a, b)
+		}
+		return
+	}
+	if a.Type() != b.Type() {
+		d.changed(path, a, b)
+		return
+	}
+
+	switch a.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if a.IsNil() || b.IsNil() {
+			break
+		}
+		ra, rb := ref{a.Pointer(), a.Type(), 0}, ref{b.Pointer(), b.Type(), 0}
+		if a.Kind() == reflect.Slice {
+			ra.len, rb.len = a.Len(), b.Len()
+		}
+		if ra == rb || d.seen[[2]ref{ra, rb}] {
+			return // identical, or already compared
+		}
+		d.seen[[2]ref{ra, rb}] = true
+	}
+
+	switch a.Kind() {
+	case reflect.Slice, reflect.Array:
+		n := a.Len()
+		if b.Len() < n {
+			n = b.Len()
+		}
+		for i := 0; i < n; i++ {
+			d.diff(fmt.Sprintf("%s[%d]", path, i), a.Index(i), b.Index(i))
+		}
+		for i := n; i < a.Len(); i++ {
+			d.side(fmt.Sprintf("%s[%d]", path, i), a.Index(i), Removed, nil)
+		}
+		for i := n; i < b.Len(); i++ {
+			d.side(fmt.Sprintf("%s[%d]", path, i), b.Index(i), Added, nil)
+		}
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			d.diff(fmt.Sprintf("%s.%s", path, a.Type().Field(i).Name), a.Field(i), b.Field(i))
+		}
+	case reflect.Map:
+		keys := a.MapKeys()
+		for _, key := range b.MapKeys() {
+			if !a.MapIndex(key).IsValid() {
+				keys = append(keys, key)
+			}
+		}
+		sortKeys(keys)
+		for _, key := range keys {
+			elemPath := fmt.Sprintf("%s[%s]", path, format.Atom(key))
+			x, y := a.MapIndex(key), b.MapIndex(key)
+			switch {
+			case !y.IsValid():
+				d.side(elemPath, x, Removed, nil)
+			case !x.IsValid():
+				d.side(elemPath, y, Added, nil)
+			default:
+				d.diff(elemPath, x, y)
+			}
+		}
+	case reflect.Ptr:
+		switch {
+		case a.IsNil() && b.IsNil():
+		case a.IsNil():
+			d.side(fmt.Sprintf("(*%s)", path), b.Elem(), Added, nil)
+		case b.IsNil():
+			d.side(fmt.Sprintf("(*%s)", path), a.Elem(), Removed, nil)
+		default:
+			d.diff(fmt.Sprintf("(*%s)", path), a.Elem(), b.Elem())
+		}
+	case reflect.Interface:
+		switch {
+		case a.IsNil() && b.IsNil():
+		case a.IsNil() || b.IsNil():
+			d.changed(path, a, b)
+		case a.Elem().Type() != b.Elem().Type():
+			d.diffs = append(d.diffs, Difference{path + ".type", Changed,
+				a.Elem().Type().String(), b.Elem().Type().String()})
+		default:
+			d.diff(path+".value", a.Elem(), b.Elem())
+		}
+	default: // basic types, channels, and funcs
+		if !equalAtoms(a, b) {
+			d.changed(path, a, b)
+		}
+	}
+}
+
+// changed records that the values at path differ as a whole.
+func (d *differ) changed(path string, a, b reflect.Value) {
+	d.diffs = append(d.diffs, Difference{path, Changed, describe(a), describe(b)})
+}
+
+// describe formats v for a Difference, spelling out nil and
+// showing only the type of a composite value.
+func describe(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return "invalid"
+	case reflect.Interface:
+		if v.IsNil() {
+			return "nil"
+		}
+		return describe(v.Elem())
+	case reflect.Ptr:
+		if v.IsNil() {
+			return "nil"
+		}
+		if k := v.Elem().Kind(); k == reflect.Ptr || k == reflect.Interface {
+			return format.Atom(v)
+		}
+		return "&" + describe(v.Elem())
+	case reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			return "nil"
+		}
+		fallthrough
+	case reflect.Array:
+		if v.Len() == 0 {
+			return v.Type().String() + "{}"
+		}
+		return v.Type().String() + "{...}"
+	case reflect.Struct:
+		if v.NumField() == 0 {
+			return v.Type().String() + "{}"
+		}
+		return v.Type().String() + "{...}"
+	}
+	return format.Atom(v)
+}
+
+// side records each leaf of v, a value found on one side only,
+// as change. Pointers in seen have already been recorded.
+func (d *differ) side(path string, v reflect.Value, change Change, seen map[ref]bool) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			break
+		}
+		r := ref{v.Pointer(), v.Type(), 0}
+		if v.Kind() == reflect.Slice {
+			r.len = v.Len()
+		}
+		if seen == nil {
+			seen = make(map[ref]bool)
+		}
+		if seen[r] {
+			return
+		}
+		seen[r] = true
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Len() > 0 {
+			for i := 0; i < v.Len(); i++ {
+				d.side(fmt.Sprintf("%s[%d]", path, i), v.Index(i), change, seen)
+			}
+			return
+		}
+	case reflect.Struct:
+		if v.NumField() > 0 {
+			for i := 0; i < v.NumField(); i++ {
+				d.side(fmt.Sprintf("%s.%s", path, v.Type().Field(i).Name), v.Field(i), change, seen)
+			}
+			return
+		}
+	case reflect.Map:
+		if v.Len() > 0 {
+			keys := v.MapKeys()
+			sortKeys(keys)
+			for _, key := range keys {
+				d.side(fmt.Sprintf("%s[%s]", path, format.Atom(key)), v.MapIndex(key), change, seen)
+			}
+			return
+		}
+	case reflect.Ptr:
+		if !v.IsNil() {
+			d.side(fmt.Sprintf("(*%s)", path), v.Elem(), change, seen)
+			return
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			d.side(path+".value", v.Elem(), change, seen)
+			return
+		}
+	}
+	// A leaf, or an empty or nil composite.
+	diff := Difference{Path: path, Change: change}
+	if change == Removed {
+		diff.Old = describe(v)
+	} else {
+		diff.New = describe(v)
+	}
+	d.diffs = append(d.diffs, diff)
+}
+
+// equalAtoms reports whether a and b, of the same basic type,
+// channel or func type, are equal.
+func equalAtoms(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() == b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() == b.Float()
+	case reflect.Complex64, reflect.Complex128:
+		return a.Complex() == b.Complex()
+	case reflect.String:
+		return a.String() == b.String()
+	}
+	return a.Pointer() == b.Pointer() // chan, func, unsafe.Pointer
+}
+
+// WriteUnified writes diffs to w in the style of a unified diff,
+// with a line for the old value of a leaf, marked -, and one for the
+// new, marked +:
+//
+//	--- x
+//	+++ y
+//	-(*x).Year = 1964
+//	+(*x).Year = 1965
+//
+// The header names the values compared, as a and b.
+func WriteUnified(w io.Writer, a, b string, diffs []Difference) error {
+	if _, err := fmt.Fprintf(w, "--- %s\n+++ %s\n", a, b); err != nil {
+		return err
+	}
+	for _, diff := range diffs {
+		if diff.Change != Added {
+			if _, err := fmt.Fprintf(w, "-%s = %s\n", diff.Path, diff.Old); err != nil {
+				return err
+			}
+		}
+		if diff.Change != Removed {
+			if _, err := fmt.Fprintf(w, "+%s = %s\n", diff.Path, diff.New); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes diffs to w as a JSON array of objects such as
+// {"path": "(*x).Year", "change": "changed", "old": "1964", "new": "1965"}.
+func WriteJSON(w io.Writer, diffs []Difference) error {
+	if diffs == nil {
+		diffs = []Difference{} // [], not null
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(diffs)
+}
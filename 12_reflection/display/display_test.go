@@ -0,0 +1,223 @@
+package display
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFprint(t *testing.T) {
+	type Cycle struct {
+		Value int
+		Tail  *Cycle
+	}
+	var c Cycle
+	c = Cycle{42, &c}
+
+	type hidden struct {
+		Name  string
+		count int
+	}
+	var iface interface{} = hidden{"x", 2}
+
+	// The shared pointer is first reached beyond the depth limit.
+	type deep struct {
+		A struct{ B struct{ C *int } }
+		D *int
+	}
+	var d deep
+	d.A.B.C = new(int)
+	d.D = d.A.B.C
+
+	tests := []struct {
+		name string
+		x    interface{}
+		opts Options
+		want string
+	}{
+		{"c", c, Options{}, `Display c (display.Cycle):
+c.Value = 42
+(*c.Tail).Value = 42
+(*c.Tail).Tail = <revisited c.Tail>
+`},
+		{"c", c, Options{MaxDepth: 2}, `Display c (display.Cycle):
+c.Value = 42
+(*c.Tail) = <display.Cycle beyond depth 2>
+`},
+		{"d", d, Options{MaxDepth: 3}, `Display d (display.deep):
+d.A.B.C = <*int beyond depth 3>
+(*d.D) = 0
+`},
+		{"m", map[int][]int{3: {1, 2, 3}, 4: {5}, 2: {4}}, Options{SortKeys: true, MaxLen: 2}, `Display m (map[int][]int):
+m[2][0] = 4
+m[3][0] = 1
+m[3][1] = 2
+m[3][...] = <1 more>
+m[...] = <1 more>
+`},
+		{"&iface", &iface, Options{}, `Display &iface (*interface {}):
+(*&iface).type = display.hidden
+(*&iface).value.Name = "x"
+`},
+		{"&iface", &iface, Options{Unexported: true}, `Display &iface (*interface {}):
+(*&iface).type = display.hidden
+(*&iface).value.Name = "x"
+(*&iface).value.count = 2
+`},
+		{"nil", []interface{}{nil, (*int)(nil)}, Options{}, `Display nil ([]interface {}):
+nil[0] = nil
+nil[1].type = *int
+nil[1].value = nil
+`},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := Fprint(&buf, test.name, test.x, test.opts); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("Fprint(%s, %+v):\n%s\nwant:\n%s", test.name, test.opts, got, test.want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	sequel := "Dr. Strangelove II"
+	a := &Movie{
+		Title: "Dr. Strangelove",
+		Year:  1964,
+		Actor: map[string]string{
+			"Dr. Strangelove":     "Peter Sellers",
+			"Gen. Buck Turgidson": "George C. Scott",
+		},
+		Oscars: []string{"Best Actor (Nomin.)", "Best Picture (Nomin.)"},
+	}
+	b := &Movie{
+		Title: "Dr. Strangelove",
+		Year:  1965,
+		Actor: map[string]string{
+			"Dr. Strangelove":      "Peter Sellers",
+			"Gen. Buck Turgidson":  "Slim Pickens",
+			"Pres. Merkin Muffley": "Peter Sellers",
+		},
+		Oscars: []string{"Best Actor (Nomin.)"},
+		Sequel: &sequel,
+	}
+	diffs := Diff(a, b)
+
+	var buf bytes.Buffer
+	if err := WriteUnified(&buf, "a", "b", diffs); err != nil {
+		t.Fatal(err)
+	}
+	const want = `--- a
++++ b
+-(*x).Year = 1964
++(*x).Year = 1965
+-(*x).Actor["Gen. Buck Turgidson"] = "George C. Scott"
++(*x).Actor["Gen. Buck Turgidson"] = "Slim Pickens"
++(*x).Actor["Pres. Merkin Muffley"] = "Peter Sellers"
+-(*x).Oscars[1] = "Best Picture (Nomin.)"
++(*(*x).Sequel) = "Dr. Strangelove II"
+`
+	if got := buf.String(); got != want {
+		t.Errorf("WriteUnified:\n%s\nwant:\n%s", got, want)
+	}
+
+	buf.Reset()
+	if err := WriteJSON(&buf, diffs[:1]); err != nil {
+		t.Fatal(err)
+	}
+	const wantJSON = `[
+  {
+    "path": "(*x).Year",
+    "change": "changed",
+    "old": "1964",
+    "new": "1965"
+  }
+]
+`
+	if got := buf.String(); got != wantJSON {
+		t.Errorf("WriteJSON:\n%s\nwant:\n%s", got, wantJSON)
+	}
+
+	// Equal values, even cyclic ones, have no differences.
+	type Cycle struct {
+		Value int
+		Tail  *Cycle
+	}
+	var c, d Cycle
+	c = Cycle{42, &c}
+	d = Cycle{42, &d}
+	if diffs := Diff(c, d); len(diffs) != 0 {
+		t.Errorf("Diff(c, d) = %v, want none", diffs)
+	}
+	d.Value = 43
+	if diffs := Diff(&c, &d); len(diffs) != 1 || diffs[0].Path != "(*x).Value" {
+		t.Errorf("Diff(&c, &d) = %v, want (*x).Value", diffs)
+	}
+
+	// Values of different types differ as a whole.
+	diffs = Diff([]interface{}{1, nil}, []interface{}{"1", 2})
+	wantDiffs := []Difference{
+		{"x[0].type", Changed, "int", "string"},
+		{"x[1]", Changed, "nil", "2"},
+	}
+	if !reflect.DeepEqual(diffs, wantDiffs) {
+		t.Errorf("Diff = %v, want %v", diffs, wantDiffs)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	type Cycle struct {
+		Name string
+		Tail *Cycle
+		Tags map[string]int
+	}
+	c := &Cycle{Name: "<b>first</b>", Tags: map[string]int{"b": 2, "a": 1}}
+	c.Tail = c
+	h := Handler("c", c)
+
+	get := func(query string) (int, string) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/?"+query, nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	// The root pointer is expanded, its struct sent along with it,
+	// and the pointer and map within left for follow-up requests.
+	code, body := get("")
+	for _, want := range []string{
+		`<h1>Display c (*display.Cycle)</h1>`,
+		`(*c).Name = &#34;&lt;b&gt;first&lt;/b&gt;&#34;`,
+		`<details data-node="0.1"><summary><a href="?node=0.1">(*c).Tail</a>`,
+		`<details data-node="0.2"><summary><a href="?node=0.2">(*c).Tags</a>`,
+	} {
+		if code != 200 || !strings.Contains(body, want) {
+			t.Errorf("GET /: got %d, body lacks %q:\n%s", code, want, body)
+		}
+	}
+	if strings.Contains(body, "(*c).Tags[") {
+		t.Errorf("GET /: map elements sent before they were asked for:\n%s", body)
+	}
+
+	code, body = get("children=0.2")
+	want := "<ul>\n<li>(*c).Tags[&#34;a&#34;] = 1</li>\n<li>(*c).Tags[&#34;b&#34;] = 2</li>\n</ul>\n"
+	if code != 200 || body != want {
+		t.Errorf("GET /?children=0.2 = %d %q, want %q", code, body, want)
+	}
+
+	// Following the cycle leads back to the same struct.
+	code, body = get("node=0.1.0")
+	if want := `(*(*c).Tail).Name = `; code != 200 || !strings.Contains(body, want) {
+		t.Errorf("GET /?node=0.1.0: got %d, body lacks %q:\n%s", code, want, body)
+	}
+
+	for _, query := range []string{"node=9", "node=0.x", "children=0.0.0", "node=-1"} {
+		if code, _ := get(query); code != http.StatusNotFound {
+			t.Errorf("GET /?%s = %d, want 404", query, code)
+		}
+	}
+}
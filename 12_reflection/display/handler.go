@@ -0,0 +1,232 @@
+package display
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopl.io/ch12/format"
+)
+
+// Handler returns an HTTP handler that lets a browser explore x, under
+// the name name, as a tree of collapsible elements labeled with their
+// paths as Display would print them. Structs, arrays and interfaces are
+// sent along with their parent, but the referents of pointers, maps and
+// slices are fetched by a follow-up request only when opened, so that
+// large or cyclic values can be explored. Unexported fields are shown.
+//
+// Nodes are addressed by the positions of their children, map elements
+// being in sorted order of their keys, so x should not change while
+// it is being explored. All text is escaped by html/template.
+func Handler(name string, x interface{}) http.Handler {
+	return &explorer{name: name, root: reflect.ValueOf(x)}
+}
+
+// An explorer is the handler returned by Handler.
+//
+// A request for /?node=0.2 gets a page showing the third child of the
+// first child of the root value, and one for /?children=0.2 the HTML
+// list of its children alone, to insert in a page.
+type explorer struct {
+	name string
+	root reflect.Value
+}
+
+func (e *explorer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	id, fragment := req.FormValue("node"), false
+	if req.Form.Has("children") {
+		id, fragment = req.FormValue("children"), true
+	}
+	path, v, ok := e.resolve(id)
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	n := newView(path, id, v, true)
+
+	var buf bytes.Buffer
+	var err error
+	if fragment {
+		err = explorerTemplate.ExecuteTemplate(&buf, "children", n)
+	} else {
+		err = explorerTemplate.Execute(&buf, struct {
+			Name, Type string
+			Node       view
+		}{e.name, typeName(e.root), n})
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// resolve returns the path and value of the node identified by id,
+// a dotted list of child positions, or false if there is none.
+func (e *explorer) resolve(id string) (string, reflect.Value, bool) {
+	path, v := e.name, e.root
+	if id == "" {
+		return path, v, true
+	}
+	for _, s := range strings.Split(id, ".") {
+		i, err := strconv.Atoi(s)
+		if err != nil || i < 0 {
+			return "", reflect.Value{}, false
+		}
+		cs := children(path, v)
+		if i >= len(cs) {
+			return "", reflect.Value{}, false
+		}
+		path, v = cs[i].path, cs[i].v
+	}
+	return path, v, true
+}
+
+// A child is an element, field, map element or referent of a value.
+type child struct {
+	path string
+	v    reflect.Value
+}
+
+// children returns the children of v, found at path,
+// in the order in which Display would print them.
+func children(path string, v reflect.Value) []child {
+	var cs []child
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			cs = append(cs, child{fmt.Sprintf("%s[%d]", path, i), v.Index(i)})
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			cs = append(cs, child{fmt.Sprintf("%s.%s", path, v.Type().Field(i).Name), v.Field(i)})
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sortKeys(keys)
+		for _, key := range keys {
+			cs = append(cs, child{fmt.Sprintf("%s[%s]", path, format.Atom(key)), v.MapIndex(key)})
+		}
+	case reflect.Ptr:
+		if !v.IsNil() {
+			cs = append(cs, child{fmt.Sprintf("(*%s)", path), v.Elem()})
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			cs = append(cs, child{path + ".value", v.Elem()})
+		}
+	}
+	return cs
+}
+
+// A view is what a page shows of a node.
+type view struct {
+	Path     string // as Display would print it
+	ID       string // for follow-up requests
+	Type     string
+	Value    string // of a leaf, or a summary of a composite
+	Lazy     bool   // children to be fetched when opened
+	Open     bool   // the node requested, shown expanded
+	Children []view
+}
+
+// newView returns the view of v, found at path, with its children
+// unless it is a pointer, map or slice and expand is false.
+func newView(path, id string, v reflect.Value, expand bool) view {
+	n := view{Path: path, ID: id, Type: typeName(v), Open: expand}
+	switch v.Kind() {
+	case reflect.Invalid:
+		n.Value = "invalid"
+		return n
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		if v.IsNil() {
+			n.Value = "nil"
+			return n
+		}
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n.Value = fmt.Sprintf("len %d", v.Len())
+	case reflect.Interface:
+		n.Value = v.Elem().Type().String()
+	case reflect.Struct:
+		if v.NumField() == 0 {
+			n.Value = "{}"
+		}
+	case reflect.Ptr:
+	default: // basic types, channels, and funcs
+		n.Value = format.Atom(v)
+		return n
+	}
+
+	cs := children(path, v)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if !expand {
+			n.Lazy = len(cs) > 0
+			return n
+		}
+	}
+	for i, c := range cs {
+		cid := strconv.Itoa(i)
+		if id != "" {
+			cid = id + "." + cid
+		}
+		n.Children = append(n.Children, newView(c.path, cid, c.v, false))
+	}
+	return n
+}
+
+func typeName(v reflect.Value) string {
+	if !v.IsValid() {
+		return "nil"
+	}
+	return v.Type().String()
+}
+
+var explorerTemplate = template.Must(template.New("explorer").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Display {{.Name}}</title>
+<style>
+body { font-family: monospace; }
+ul { list-style: none; padding-left: 1.5em; }
+.type { color: #888; }
+</style>
+</head>
+<body>
+<h1>Display {{.Name}} ({{.Type}})</h1>
+<ul>{{template "node" .Node}}</ul>
+<script>
+// Fetch the children of a lazy node the first time it is opened.
+document.addEventListener("toggle", function(event) {
+	var d = event.target;
+	if (!d.open || !d.dataset.node || d.dataset.loaded) {
+		return;
+	}
+	d.dataset.loaded = "true";
+	fetch("?children=" + encodeURIComponent(d.dataset.node))
+		.then(function(resp) { return resp.text(); })
+		.then(function(html) { d.insertAdjacentHTML("beforeend", html); });
+}, true);
+</script>
+</body>
+</html>
+{{define "node"}}<li>
+{{- if .Lazy}}<details data-node="{{.ID}}"><summary>{{template "summary" .}}</summary></details>
+{{- else if .Children}}<details{{if .Open}} open{{end}}><summary>{{template "summary" .}}</summary>{{template "children" .}}</details>
+{{- else}}{{.Path}} = {{.Value}}{{end -}}
+</li>
+{{end}}
+{{define "children"}}<ul>
+{{range .Children}}{{template "node" .}}{{end -}}
+</ul>
+{{end}}
+{{define "summary"}}<a href="?node={{.ID}}">{{.Path}}</a> <span class="type">{{.Type}}</span> {{.Value}}{{end}}
+`))
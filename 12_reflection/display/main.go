@@ -2,67 +2,179 @@ package display
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"reflect"
-	"strconv"
+	"sort"
+
+	"gopl.io/ch12/format"
 )
 
 // Display is a debugging utility that given an arbitrarily complex value `x`,
 // prints the complete structure of that value, labeling each element with the
 // path by which it was found.
 func Display(name string, x interface{}) {
-	fmt.Printf("Display %s (%T):\n", name, x)
-	display(name, reflect.ValueOf(x))
+	Fprint(os.Stdout, name, x, Options{})
+}
+
+// Options control how Fprint walks a value.
+// The zero Options print the whole value, in map iteration order,
+// without unexported fields.
+type Options struct {
+	MaxDepth   int  // levels of nesting to descend into; 0 means no limit
+	MaxLen     int  // elements to print of each array, slice or map; 0 means no limit
+	SortKeys   bool // print map elements in order of their keys
+	Unexported bool // print unexported struct fields too
+}
+
+// Fprint is like Display but writes to w, as directed by opts.
+// A pointer, map or slice already printed is not printed again
+// but shown as <revisited path>, naming the path at which it was
+// first found, so that Fprint terminates even on cyclic values.
+// It returns the first error encountered writing to w.
+func Fprint(w io.Writer, name string, x interface{}, opts Options) error {
+	p := &printer{w: w, opts: opts, seen: make(map[ref]string)}
+	p.printf("Display %s (%T):\n", name, x)
+	p.display(name, reflect.ValueOf(x), 0)
+	return p.err
+}
+
+// A printer holds the state of a single call to Fprint.
+type printer struct {
+	w    io.Writer
+	err  error // first write error
+	opts Options
+	seen map[ref]string // path of each pointer, map and slice printed
+}
+
+// A ref identifies the referent of a pointer, map or slice.
+// The type distinguishes a struct from its first field, and the
+// length a slice from a shorter one sharing its array.
+type ref struct {
+	ptr uintptr
+	t   reflect.Type
+	len int
 }
 
-func display(path string, v reflect.Value) {
+func (p *printer) printf(format string, args ...interface{}) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format, args...)
+	}
+}
+
+func (p *printer) display(path string, v reflect.Value, depth int) {
+	// Check the depth first, so that a referent cut off here is not
+	// recorded as seen, and is printed in full if found on a shorter path.
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Map, reflect.Struct, reflect.Ptr, reflect.Interface:
+		if p.opts.MaxDepth > 0 && depth >= p.opts.MaxDepth && !isNil(v) {
+			p.printf("%s = <%s beyond depth %d>\n", path, v.Type(), p.opts.MaxDepth)
+			return
+		}
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if v.IsNil() || v.Kind() != reflect.Ptr && v.Len() == 0 {
+			break
+		}
+		r := ref{v.Pointer(), v.Type(), 0}
+		if v.Kind() == reflect.Slice {
+			r.len = v.Len()
+		}
+		if first, ok := p.seen[r]; ok {
+			p.printf("%s = <revisited %s>\n", path, first)
+			return
+		}
+		p.seen[r] = path
+	}
+
 	switch v.Kind() {
 	case reflect.Invalid:
-		fmt.Printf("%s = invalid\n", path)
+		p.printf("%s = invalid\n", path)
 	case reflect.Slice, reflect.Array:
-		for i := 0; i < v.Len(); i++ {
-			display(fmt.Sprintf("%s[%d]", path, i), v.Index(i))
+		n := p.limit(v.Len())
+		for i := 0; i < n; i++ {
+			p.display(fmt.Sprintf("%s[%d]", path, i), v.Index(i), depth+1)
+		}
+		p.more(path, v.Len()-n)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if t.Field(i).PkgPath != "" && !p.opts.Unexported {
+				continue
+			}
+			p.display(fmt.Sprintf("%s.%s", path, t.Field(i).Name), v.Field(i), depth+1)
 		}
 	case reflect.Map:
-		for _, key := range v.MapKeys() {
-			display(fmt.Sprintf("%s[%s]", path, formatAtom(key)), v.MapIndex(key))
+		keys := v.MapKeys()
+		if p.opts.SortKeys {
+			sortKeys(keys)
+		}
+		n := p.limit(len(keys))
+		for _, key := range keys[:n] {
+			p.display(fmt.Sprintf("%s[%s]", path, format.Atom(key)), v.MapIndex(key), depth+1)
 		}
+		p.more(path, len(keys)-n)
 	case reflect.Ptr:
 		if v.IsNil() {
-			fmt.Printf("%s = nil\n", path)
+			p.printf("%s = nil\n", path)
 		} else {
-			display(fmt.Sprintf("(*%s)", path), v.Elem())
+			p.display(fmt.Sprintf("(*%s)", path), v.Elem(), depth+1)
 		}
 	case reflect.Interface:
 		if v.IsNil() {
-			fmt.Printf("s = nil\n", path)
+			p.printf("%s = nil\n", path)
 		} else {
-			fmt.Printf("s.type = %s\n", path, v.Elem().Type())
-			display(path+".value", v.Elem())
+			p.printf("%s.type = %s\n", path, v.Elem().Type())
+			p.display(path+".value", v.Elem(), depth+1)
 		}
 	default: // basic types, channels, and funcs
-		fmt.Printf("%s = %s\n", path, formatAtom(v))
+		p.printf("%s = %s\n", path, format.Atom(v))
 	}
 }
 
-// from ../format/format.go
-func formatAtom(v reflect.Value) string {
+func isNil(v reflect.Value) bool {
 	switch v.Kind() {
-	case reflect.Invalid:
-		return "Invalid"
-	case reflect.Int, reflect.Int8, reflect.Int16,
-		reflect.Int32, reflect.Int64:
-		return strconv.FormatInt(v.Int(), 10)
-	case reflect.Uint, reflect.Uint8, reflect.Uint16,
-		reflect.Uint32, reflect.Uint64:
-		return strconv.FormatUint(v.Uint(), 10)
-	// ..floating point and complex cases omitted for brevity...
-	case reflect.Bool:
-		return strconv.FormatBool(v.Bool())
-	case reflect.String:
-		return strconv.Quote(v.String())
-	case reflect.Chan, reflect.Func, reflect.Ptr, reflect.Slice, reflect.Map:
-		return v.Type().String() + " 0x" + strconv.FormatUint(uint64(v.Pointer()), 16)
-	default: // reflect.Array, reflect.Struct, reflect.Interface
-		return v.Type().String() + " value"
+	case reflect.Map, reflect.Ptr, reflect.Interface, reflect.Slice:
+		return v.IsNil()
+	}
+	return false
+}
+
+// limit returns how many of n elements to print.
+func (p *printer) limit(n int) int {
+	if p.opts.MaxLen > 0 && n > p.opts.MaxLen {
+		return p.opts.MaxLen
+	}
+	return n
+}
+
+// more notes the n elements of path left unprinted.
+func (p *printer) more(path string, n int) {
+	if n > 0 {
+		p.printf("%s[...] = <%d more>\n", path, n)
 	}
 }
+
+// sortKeys sorts map keys: numbers, strings and bools by value,
+// and other keys by their formatted text.
+func sortKeys(keys []reflect.Value) {
+	sort.Slice(keys, func(i, j int) bool {
+		x, y := keys[i], keys[j]
+		if x.Kind() == y.Kind() {
+			switch x.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				return x.Int() < y.Int()
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+				return x.Uint() < y.Uint()
+			case reflect.Float32, reflect.Float64:
+				return x.Float() < y.Float()
+			case reflect.String:
+				return x.String() < y.String()
+			case reflect.Bool:
+				return !x.Bool() && y.Bool()
+			}
+		}
+		return format.Atom(x) < format.Atom(y)
+	})
+}
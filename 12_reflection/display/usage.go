@@ -1,5 +1,7 @@
 package display
 
+import "os"
+
 type Movie struct {
 	Title, Subtitle string
 	Year            int
@@ -45,7 +47,7 @@ func example() {
 	*/
 
 	// can also be used to display internals of library types such as *os.File
-	// Display ("os.Stderr", os.Stderr)
+	// Fprint(os.Stdout, "os.Stderr", os.Stderr, Options{Unexported: true})
 	// Output:
 	// (*(*os.Stderr).file).fd = 2)
 	// (*(*os.Stderr).file).name = "/dev/stderr")
@@ -67,7 +69,7 @@ func example() {
 	// (*&i).type = int
 	// (*&i).value = 3
 
-	/* Example of issues with cycles as currently implemented */
+	/* Example of a cycle */
 	// a struct that points to itself
 	type Cycle struct {
 		Value int
@@ -76,11 +78,29 @@ func example() {
 	var c Cycle
 	c = Cycle{42, &c}
 	Display("c", c)
-	// Would print the ever growing expansion
+	// Rather than the ever growing expansion
+	// (*(*(*c.Tail).Tail).Tail).Value = 42 ad infinitum,
+	// a pointer is followed only the first time:
 	// Display c (display.Cycle):
 	// c.Value = 42
 	// (*c.Tail).Value = 42
-	// (*(*c.Tail).Tail).Value = 42
-	// (*(*(*c.Tail).Tail).Tail).Value = 42
-	// ... ad infinitum ...
+	// (*c.Tail).Tail = <revisited c.Tail>
+
+	// Fprint limits the output of large values.
+	Fprint(os.Stdout, "strangelove", strangelove, Options{MaxLen: 2, SortKeys: true})
+	// Display strangelove (display.Movie):
+	// strangelove.Title = "Dr. Strangelove"
+	// ...
+	// strangelove.Actor["Brig. Gen. Jack D. Ripper"] = "Sterling Hayden"
+	// strangelove.Actor["Dr.Strangelove"] = "Peter Sellers"
+	// strangelove.Actor[...] = <4 more>
+	// strangelove.Oscars[0] = "Best Actor (Nomin.)"
+	// strangelove.Oscars[1] = "Best Adapated Screenplay (Nomin.)"
+	// strangelove.Oscars[...] = <2 more>
+	// strangelove.Sequel = nil
+
+	// Handler serves a value for exploring in a browser; the cycle
+	// above can be followed one click at a time.
+	// http.Handle("/debug/cycle", Handler("c", &c))
+	// log.Fatal(http.ListenAndServe("localhost:8000", nil))
 }
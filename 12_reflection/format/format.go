@@ -1,17 +1,24 @@
+// Package format formats values of any type using reflection.
 package format
 
 import (
 	"reflect"
 	"strconv"
+	"strings"
 )
 
 // Any formats any value as a string.
 func Any(value interface{}) string {
-	return formatAtom(reflect.ValueOf(value))
+	return Atom(reflect.ValueOf(value))
 }
 
-// formatAtom formats a value without inspecting its internal structure.
-func formatAtom(v reflect.Value) string {
+// Atom formats a value without following its references: numbers of
+// every kind, bools and quoted strings are written as in Go, arrays
+// and structs by their elements, as in [2]int{1, 2} and
+// image.Point{X: 1, Y: 2}, and interfaces by their dynamic value.
+// Pointers, slices, maps, channels and funcs are written as their
+// type and address, as in *int 0xc000012345.
+func Atom(v reflect.Value) string {
 	switch v.Kind() {
 	case reflect.Invalid:
 		return "Invalid"
@@ -19,17 +26,35 @@ func formatAtom(v reflect.Value) string {
 		reflect.Int32, reflect.Int64:
 		return strconv.FormatInt(v.Int(), 10)
 	case reflect.Uint, reflect.Uint8, reflect.Uint16,
-		reflect.Uint32, reflect.Uint64:
+		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		return strconv.FormatUint(v.Uint(), 10)
-	// ..floating point and complex cases omitted for brevity...
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	case reflect.Complex64, reflect.Complex128:
+		return strconv.FormatComplex(v.Complex(), 'g', -1, v.Type().Bits())
 	case reflect.Bool:
 		return strconv.FormatBool(v.Bool())
 	case reflect.String:
 		return strconv.Quote(v.String())
-	case reflect.Chan, reflect.Func, reflect.Ptr, reflect.Slice, reflect.Map:
+	case reflect.Array:
+		elems := make([]string, v.Len())
+		for i := range elems {
+			elems[i] = Atom(v.Index(i))
+		}
+		return v.Type().String() + "{" + strings.Join(elems, ", ") + "}"
+	case reflect.Struct:
+		fields := make([]string, v.NumField())
+		for i := range fields {
+			fields[i] = v.Type().Field(i).Name + ": " + Atom(v.Field(i))
+		}
+		return v.Type().String() + "{" + strings.Join(fields, ", ") + "}"
+	case reflect.Interface:
+		if v.IsNil() {
+			return "nil"
+		}
+		return Atom(v.Elem())
+	default: // reflect.Chan, Func, Ptr, Slice, Map, UnsafePointer
 		return v.Type().String() + " 0x" + strconv.FormatUint(uint64(v.Pointer()), 16)
-	default: // reflect.Array, reflect.Struct, reflect.Interface
-		return v.Type().String() + " value"
 	}
 }
 
@@ -41,4 +66,10 @@ fmt.Println(format.Any(x))
 fmt.Println(format.Any(d))
 fmt.Println(format.Any([]int64{x})) // "[]int64 0xhhhhhhhh"
 fmt.Println(format.Any([]time.Duration{d})) // "[]time.Duration 0xhhhhhhhh"
+fmt.Println(format.Any(2.5+1i)) // "(2.5+1i)"
+fmt.Println(format.Any(image.Pt(1, 2))) // "image.Point{X: 1, Y: 2}"
+
+s, _ := format.GoSyntax([]image.Point{{1, 2}})
+fmt.Println(s)
+// []image.Point{{X: 1, Y: 2}}
 */
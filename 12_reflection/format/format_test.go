@@ -0,0 +1,188 @@
+package format
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+type point struct{ X, Y int }
+
+type label string
+
+func TestAny(t *testing.T) {
+	var iface interface{} = point{1, 2}
+	tests := []struct {
+		x    interface{}
+		want string
+	}{
+		{nil, "Invalid"},
+		{int8(-3), "-3"},
+		{uintptr(7), "7"},
+		{1.5, "1.5"},
+		{float32(0.1), "0.1"},
+		{math.Inf(-1), "-Inf"},
+		{complex(1, -2), "(1-2i)"},
+		{complex64(0.5i), "(0+0.5i)"},
+		{"a\tb", `"a\tb"`},
+		{time.Second, "1000000000"},
+		{[2]bool{true, false}, "[2]bool{true, false}"},
+		{point{1, 2}, "format.point{X: 1, Y: 2}"},
+		{[]interface{}{iface}[0], "format.point{X: 1, Y: 2}"},
+		{struct{ P *int }{}, "struct { P *int }{P: *int 0x0}"},
+	}
+	for _, test := range tests {
+		if got := Any(test.x); got != test.want {
+			t.Errorf("Any(%#v) = %s, want %s", test.x, got, test.want)
+		}
+	}
+}
+
+func TestGoSyntax(t *testing.T) {
+	type tree struct {
+		Name  string
+		Kids  []*tree
+		Attrs map[string]interface{}
+		When  time.Time
+		Ratio *float64
+		Ch    chan int
+	}
+	half := 0.5
+	tests := []struct {
+		x    interface{}
+		want string
+	}{
+		{nil, "nil"},
+		{42, "42"},
+		{uint8(7), "uint8(7)"},
+		{2.0, "2.0"},
+		{float32(1e21), "float32(1e+21)"},
+		{math.NaN(), "math.NaN()"},
+		{float32(math.Inf(1)), "float32(math.Inf(1))"},
+		{math.Copysign(0, -1), "math.Copysign(0, -1)"},
+		{complex(1, 2), "(1 + 2i)"},
+		{complex64(complex(math.NaN(), 1)), "complex64(complex(math.NaN(), 1.0))"},
+		{"x", `"x"`},
+		{'x', "int32(120)"},
+		{time.Second, "time.Duration(1000000000)"},
+		{[]time.Duration{time.Second}, "[]time.Duration{1000000000}"},
+		{[]int(nil), "[]int(nil)"},
+		{(*int)(nil), "(*int)(nil)"},
+		{[]float32{1, 2.5}, "[]float32{1.0, 2.5}"},
+		{[]interface{}{1, int64(2), nil}, "[]interface{}{1, int64(2), nil}"},
+		{&half, "func() *float64 { var v float64 = 0.5; return &v }()"},
+		{new(string), "new(string)"},
+		{func() *uint8 { v := uint8(7); return &v }(), "func() *uint8 { var v uint8 = 7; return &v }()"},
+		{func() *float32 { v := float32(math.Inf(1)); return &v }(), "func() *float32 { var v float32 = float32(math.Inf(1)); return &v }()"},
+		{func() *label { v := label("x"); return &v }(), `func() *format.label { var v format.label = "x"; return &v }()`},
+		{func() *interface{} { var v interface{} = 1; return &v }(), "func() *interface{} { var v interface{} = 1; return &v }()"},
+		{map[int]string{10: "b", 9: "a"}, `map[int]string{10: "b", 9: "a"}`},
+		{[]point{{1, 2}, {}}, "[]format.point{{X: 1, Y: 2}, {}}"},
+		{[]*point{{1, 2}}, "[]*format.point{{X: 1, Y: 2}}"},
+		{[]interface{}{&point{1, 2}}, "[]interface{}{&format.point{X: 1, Y: 2}}"},
+		{map[point]bool{{2, 1}: true}, "map[format.point]bool{{X: 2, Y: 1}: true}"},
+		{time.Date(2024, 2, 29, 12, 0, 0, 5, time.UTC), "time.Date(2024, time.February, 29, 12, 0, 0, 5, time.UTC)"},
+		{&tree{
+			Name: "root",
+			Kids: []*tree{{Name: "leaf", Ratio: &half}, nil},
+			Attrs: map[string]interface{}{
+				"size": uint(3),
+				"tags": []string{"a", "b"},
+			},
+			When: time.Date(2001, 1, 1, 0, 0, 0, 0, time.FixedZone("EST", -5*3600)),
+		}, `&format.tree{
+	Name: "root",
+	Kids: []*format.tree{
+		{
+			Name:  "leaf",
+			Ratio: func() *float64 { var v float64 = 0.5; return &v }(),
+		},
+		nil,
+	},
+	Attrs: map[string]interface{}{"size": uint(3), "tags": []string{"a", "b"}},
+	When:  time.Date(2001, time.January, 1, 0, 0, 0, 0, time.FixedZone("EST", -18000)),
+}`},
+	}
+	for _, test := range tests {
+		got, err := GoSyntax(test.x)
+		if err != nil {
+			t.Errorf("GoSyntax(%#v): %v", test.x, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("GoSyntax(%#v) =\n%s\nwant\n%s", test.x, got, test.want)
+		}
+		if err := typecheck(got); err != nil {
+			t.Errorf("GoSyntax(%#v) = %s: %v", test.x, got, err)
+		}
+	}
+
+	// Values that have no Go syntax.
+	type list struct {
+		Next *list
+	}
+	cycle := &list{}
+	cycle.Next = cycle
+	loop := []interface{}{nil}
+	loop[0] = loop
+	for _, test := range []struct {
+		x    interface{}
+		want string
+	}{
+		{cycle, "cyclic value of type *format.list"},
+		{loop, "cyclic value of type []interface {}"},
+		{tree{Ch: make(chan int)}, "cannot write chan int"},
+		{[]func(){func() {}}, "cannot write func()"},
+	} {
+		if got, err := GoSyntax(test.x); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("GoSyntax(%#v) = %q, %v, want error containing %q", test.x, got, err, test.want)
+		}
+	}
+}
+
+var (
+	fset           = token.NewFileSet()
+	sourceImporter = importer.ForCompiler(fset, "source", nil)
+)
+
+// typecheck reports whether expr compiles in a package that imports
+// math and time and that declares the types used by TestGoSyntax.
+// References to package format are made local to that package.
+func typecheck(expr string) error {
+	src := `package format
+
+import (
+	"math"
+	"time"
+)
+
+type point struct{ X, Y int }
+
+type label string
+
+type tree struct {
+	Name  string
+	Kids  []*tree
+	Attrs map[string]interface{}
+	When  time.Time
+	Ratio *float64
+	Ch    chan int
+}
+
+var _ = math.Pi
+
+var _ interface{} = ` + strings.ReplaceAll(expr, "format.", "") + "\n"
+	f, err := parser.ParseFile(fset, "fixture.go", src, 0)
+	if err != nil {
+		return err
+	}
+	conf := types.Config{Importer: sourceImporter}
+	_, err = conf.Check("format", fset, []*ast.File{f}, nil)
+	return err
+}
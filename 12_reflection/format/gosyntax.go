@@ -0,0 +1,297 @@
+package format
+
+import (
+	"fmt"
+	gofmt "go/format"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GoSyntax returns a Go expression, much like the %#v verb of fmt
+// but one that compiles, that evaluates to a copy of value: pointers,
+// slices and maps are followed and written as composite literals,
+// nested ones with their types elided where Go allows, so that the
+// expression can serve as a test fixture built from live data.
+// The expression is formatted as by gofmt.
+//
+// Zero struct fields are omitted. Basic values are converted to
+// their type, as in uint8(7), unless it is implied by the context.
+// Map entries are sorted by the text of their keys. A time.Time is
+// written as a call to time.Date, and infinities, NaNs and negative
+// zeros by calls to functions of package math; types are written as
+// by reflect.Type.String. The expression compiles wherever those
+// packages, and the packages of the types, are imported, except that
+// a struct with non-zero unexported fields compiles only within the
+// package that defines it.
+//
+// Pointers, maps and slices that are shared are copied separately.
+// GoSyntax fails on cyclic values, non-nil channels, funcs and unsafe
+// pointers, and times it cannot read, which have no literal form.
+func GoSyntax(value interface{}) (string, error) {
+	w := &goWriter{active: make(map[ref]bool)}
+	s, err := w.expr(reflect.ValueOf(value), nil, false)
+	if err != nil {
+		return "", err
+	}
+	const prefix = "package p\n\nvar _ = "
+	src, err := gofmt.Source([]byte(prefix + s))
+	if err != nil {
+		return s, nil // valid, if oddly laid out
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(string(src), prefix), "\n"), nil
+}
+
+// A goWriter holds the state of a single call to GoSyntax.
+type goWriter struct {
+	active map[ref]bool // pointers, maps and slices being written
+}
+
+// A ref identifies the referent of a pointer, map or slice.
+type ref struct {
+	ptr uintptr
+	t   reflect.Type
+	len int
+}
+
+var (
+	intType        = reflect.TypeOf(0)
+	float64Type    = reflect.TypeOf(0.0)
+	complex128Type = reflect.TypeOf(0i)
+	stringType     = reflect.TypeOf("")
+	boolType       = reflect.TypeOf(false)
+	timeType       = reflect.TypeOf(time.Time{})
+)
+
+// expr returns an expression for v where a value of type ctx is
+// expected, ctx being nil if the expression must convey its own type.
+// If elide is true, the expression is an element or key of a
+// composite literal, and may be a literal with its type left out.
+func (w *goWriter) expr(v reflect.Value, ctx reflect.Type, elide bool) (string, error) {
+	if !v.IsValid() {
+		return "nil", nil
+	}
+	t := v.Type()
+	implicit := ctx == t
+	switch v.Kind() {
+	case reflect.Bool:
+		return convert(t, implicit, strconv.FormatBool(v.Bool()), boolType), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return convert(t, implicit, strconv.FormatInt(v.Int(), 10), intType), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return convert(t, implicit, strconv.FormatUint(v.Uint(), 10), nil), nil
+	case reflect.Float32, reflect.Float64:
+		s, ok := float(v.Float(), t.Bits())
+		return convert(t, implicit && ok, s, float64Type), nil
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		re, ok1 := float(real(c), t.Bits()/2)
+		im, ok2 := float(imag(c), t.Bits()/2)
+		if !ok1 || !ok2 { // not a constant
+			return convert(t, false, "complex("+re+", "+im+")", complex128Type), nil
+		}
+		return convert(t, implicit, strconv.FormatComplex(c, 'g', -1, t.Bits()), complex128Type), nil
+	case reflect.String:
+		return convert(t, implicit, strconv.Quote(v.String()), stringType), nil
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		if v.IsNil() {
+			return nilExpr(t, implicit), nil
+		}
+		return "", fmt.Errorf("format: cannot write %s as Go syntax", t)
+	case reflect.Interface:
+		if v.IsNil() {
+			return "nil", nil
+		}
+		return w.expr(v.Elem(), nil, false)
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return nilExpr(t, implicit), nil
+		}
+		r := ref{v.Pointer(), t, 0}
+		if v.Kind() == reflect.Slice {
+			r.len = v.Len()
+		}
+		if w.active[r] {
+			return "", fmt.Errorf("format: cannot write cyclic value of type %s", t)
+		}
+		w.active[r] = true
+		defer delete(w.active, r)
+	}
+
+	typ := t.String() // of a composite literal
+	if elide && implicit {
+		typ = ""
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		elem := v.Elem()
+		if isComposite(elem.Type()) {
+			s, err := w.expr(elem, elem.Type(), elide && implicit)
+			if err != nil || elide && implicit {
+				return s, err
+			}
+			return "&" + s, nil
+		}
+		if elem.IsZero() {
+			return "new(" + elem.Type().String() + ")", nil
+		}
+		s, err := w.expr(elem, elem.Type(), false)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("func() %s { var v %s = %s; return &v }()", t, elem.Type(), s), nil
+
+	case reflect.Array, reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			s, err := w.expr(v.Index(i), t.Elem(), true)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return composite(typ, items), nil
+
+	case reflect.Map:
+		type entry struct {
+			key  reflect.Value
+			text string
+		}
+		var entries []entry
+		for _, key := range v.MapKeys() {
+			k, err := w.expr(key, t.Key(), true)
+			if err != nil {
+				return "", err
+			}
+			entries = append(entries, entry{key, k})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].text < entries[j].text })
+		items := make([]string, len(entries))
+		for i, e := range entries {
+			elem, err := w.expr(v.MapIndex(e.key), t.Elem(), true)
+			if err != nil {
+				return "", err
+			}
+			items[i] = e.text + ": " + elem
+		}
+		return composite(typ, items), nil
+
+	case reflect.Struct:
+		if t == timeType {
+			return timeExpr(v)
+		}
+		var items []string
+		for i := 0; i < v.NumField(); i++ {
+			f := t.Field(i)
+			if f.Name == "_" || v.Field(i).IsZero() {
+				continue
+			}
+			s, err := w.expr(v.Field(i), f.Type, false)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, f.Name+": "+s)
+		}
+		return composite(typ, items), nil
+	}
+	panic("unreachable")
+}
+
+// convert returns the constant lit, whose default type is def,
+// converted to type t unless the conversion is implicit.
+func convert(t reflect.Type, implicit bool, lit string, def reflect.Type) string {
+	if implicit || t == def {
+		return lit
+	}
+	return t.String() + "(" + lit + ")"
+}
+
+// nilExpr returns nil as an expression of type t.
+func nilExpr(t reflect.Type, implicit bool) string {
+	if implicit {
+		return "nil"
+	}
+	s := t.String()
+	if strings.HasPrefix(s, "*") || strings.HasPrefix(s, "func") ||
+		strings.HasPrefix(s, "chan") || strings.HasPrefix(s, "<-") {
+		s = "(" + s + ")"
+	}
+	return s + "(nil)"
+}
+
+// float returns a floating-point constant equal to f, of the given
+// bit size, or, if there is none, an expression of type float64 and false.
+func float(f float64, bits int) (string, bool) {
+	switch {
+	case math.IsNaN(f):
+		return "math.NaN()", false
+	case math.IsInf(f, 1):
+		return "math.Inf(1)", false
+	case math.IsInf(f, -1):
+		return "math.Inf(-1)", false
+	case f == 0 && math.Signbit(f):
+		return "math.Copysign(0, -1)", false
+	}
+	s := strconv.FormatFloat(f, 'g', -1, bits)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0" // a floating-point constant, not an integer
+	}
+	return s, true
+}
+
+// isComposite reports whether values of type t are written as
+// composite literals.
+func isComposite(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Map:
+		return true
+	case reflect.Struct:
+		return t != timeType
+	}
+	return false
+}
+
+// composite returns the composite literal of type typ, which may be
+// empty, with the given elements, on one line if they are short.
+func composite(typ string, items []string) string {
+	n := 0
+	for _, item := range items {
+		n += len(item) + 2
+		if strings.Contains(item, "\n") {
+			n += 80
+		}
+	}
+	if n <= 72 {
+		return typ + "{" + strings.Join(items, ", ") + "}"
+	}
+	return typ + "{\n" + strings.Join(items, ",\n") + ",\n}"
+}
+
+// timeExpr returns a call to time.Date that gives the time v.
+func timeExpr(v reflect.Value) (string, error) {
+	if !v.CanInterface() {
+		return "", fmt.Errorf("format: cannot read time.Time in unexported field")
+	}
+	t := v.Interface().(time.Time)
+	if t.IsZero() {
+		return "time.Time{}", nil
+	}
+	var loc string
+	switch t.Location() {
+	case time.UTC:
+		loc = "time.UTC"
+	case time.Local:
+		loc = "time.Local"
+	default:
+		name, offset := t.Zone()
+		loc = fmt.Sprintf("time.FixedZone(%q, %d)", name, offset)
+	}
+	return fmt.Sprintf("time.Date(%d, time.%s, %d, %d, %d, %d, %d, %s)",
+		t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc), nil
+}
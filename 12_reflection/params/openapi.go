@@ -0,0 +1,229 @@
+package params
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A Document is an OpenAPI 3 description of an API,
+// as produced by Router.Spec.
+type Document struct {
+	OpenAPI string                           `json:"openapi"`
+	Info    Info                             `json:"info"`
+	Paths   map[string]map[string]*Operation `json:"paths"` // path, then method
+}
+
+// Info gives the title and version of an API.
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// An Operation describes the handling of one method on one path.
+type Operation struct {
+	Summary    string              `json:"summary,omitempty"`
+	Parameters []*Parameter        `json:"parameters,omitempty"`
+	Responses  map[string]Response `json:"responses"` // by status code
+}
+
+// A Response describes a response to an operation.
+type Response struct {
+	Description string `json:"description"`
+}
+
+// A Parameter is an OpenAPI parameter object.
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"` // always "query"
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+// A Schema describes the values of a parameter. Of the constraints,
+// only those that apply to its type are set.
+type Schema struct {
+	Type      string        `json:"type"`
+	Format    string        `json:"format,omitempty"`
+	Items     *Schema       `json:"items,omitempty"`
+	Default   interface{}   `json:"default,omitempty"`
+	Enum      []interface{} `json:"enum,omitempty"`
+	Minimum   *float64      `json:"minimum,omitempty"`
+	Maximum   *float64      `json:"maximum,omitempty"`
+	MinLength *int          `json:"minLength,omitempty"`
+	MaxLength *int          `json:"maxLength,omitempty"`
+	MinItems  *int          `json:"minItems,omitempty"`
+	MaxItems  *int          `json:"maxItems,omitempty"`
+	Pattern   string        `json:"pattern,omitempty"`
+}
+
+// Parameters returns the OpenAPI definitions of the query parameters
+// that Unpack decodes into the struct pointed to by ptr, with their
+// types and the constraints of their validate tags. The struct serves
+// as a prototype: its non-zero fields, which a handler would use as
+// defaults, give the parameters' default values. Files are left out,
+// as they are not query parameters.
+func Parameters(ptr interface{}) ([]*Parameter, error) {
+	v := reflect.Indirect(reflect.ValueOf(ptr))
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("params: Parameters(%T): want pointer to struct", ptr)
+	}
+	fs, err := fields(v.Type())
+	if err != nil {
+		return nil, err
+	}
+	var params []*Parameter
+	for _, f := range fs {
+		if f.Type == fileType || f.Type == filesType {
+			continue
+		}
+		p := &Parameter{Name: f.name, In: "query", Schema: schema(f.Type)}
+		if fv, ok := lookup(v, f.index); ok && !fv.IsZero() {
+			if p.Schema.Default, err = defaultValue(f.name, fv); err != nil {
+				return nil, err
+			}
+		}
+		for _, r := range f.rules {
+			p.Required = p.Required || r.name == "required"
+			constrain(p.Schema, f.Type, r)
+		}
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+// schema returns the schema of a parameter of type t,
+// without constraints.
+func schema(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case durationType:
+		return &Schema{Type: "string", Format: "duration"}
+	}
+	if isList(t) {
+		return &Schema{Type: "array", Items: schema(t.Elem())}
+	}
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return &Schema{Type: "string"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer", Format: intFormat(t)}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		zero := 0.0
+		return &Schema{Type: "integer", Format: intFormat(t), Minimum: &zero}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	}
+	return &Schema{Type: "string"}
+}
+
+func intFormat(t reflect.Type) string {
+	if t.Bits() > 32 {
+		return "int64"
+	}
+	return "int32"
+}
+
+// constrain adds to s, the schema of a field of type t, the
+// constraint expressed by rule r, if OpenAPI can express it.
+func constrain(s *Schema, t reflect.Type, r rule) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	item := s // the schema to which rules other than min and max apply
+	if s.Items != nil {
+		item = s.Items
+	}
+	switch r.name {
+	case "min", "max":
+		n := int(r.limit)
+		switch {
+		case t == durationType: // no way to say
+		case s.Type == "array":
+			s.MinItems, s.MaxItems = bound(r.name, &n, s.MinItems, s.MaxItems)
+		case s.Type == "string":
+			s.MinLength, s.MaxLength = bound(r.name, &n, s.MinLength, s.MaxLength)
+		default:
+			limit := r.limit
+			s.Minimum, s.Maximum = bound(r.name, &limit, s.Minimum, s.Maximum)
+		}
+	case "email":
+		item.Format = "email"
+	case "oneof":
+		for _, choice := range strings.Fields(r.arg) {
+			item.Enum = append(item.Enum, enumValue(item.Type, choice))
+		}
+	case "regexp":
+		item.Pattern = r.arg
+	}
+}
+
+// bound sets min or max, as named by rule, to x.
+func bound[T any](rule string, x, min, max *T) (*T, *T) {
+	if rule == "min" {
+		return x, max
+	}
+	return min, x
+}
+
+// enumValue returns the choice of a oneof rule as a
+// JSON value of the schema type typ.
+func enumValue(typ, choice string) interface{} {
+	switch typ {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(choice, 64); err == nil {
+			return json.Number(choice)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(choice); err == nil {
+			return b
+		}
+	}
+	return choice
+}
+
+// defaultValue returns the value of field v, named name, as a JSON
+// value: a number or boolean if it is one, a list for a slice, and
+// otherwise its parameter text as packed by Pack.
+func defaultValue(name string, v reflect.Value) (interface{}, error) {
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if isList(v.Type()) {
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			x, err := defaultValue(name, v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = x
+		}
+		return list, nil
+	}
+	form := make(url.Values)
+	if err := pack(form, name, v); err != nil {
+		return nil, err
+	}
+	text := form.Get(name)
+	if t := v.Type(); t != durationType && !t.Implements(textMarshalerType) {
+		switch {
+		case t.Kind() == reflect.Bool:
+			return v.Bool(), nil
+		case isNumber(t):
+			return json.Number(text), nil
+		}
+	}
+	return text, nil
+}
@@ -0,0 +1,131 @@
+package params
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Pack returns the URL parameters that Unpack would decode into the
+// struct pointed to by ptr, so that Unpack(Pack(x)) recovers x.
+// Parameters are named by the same rules as for Unpack.
+//
+// A slice field gives a parameter for each of its elements, and a
+// nil pointer none. Other fields are packed even when they hold the
+// zero value, since Unpack might otherwise leave a default in place,
+// unless they are tagged omitempty, as in `http:"max,omitempty"`.
+// Files, which cannot be sent in a query string, are left out.
+func Pack(ptr interface{}) (url.Values, error) {
+	v := reflect.Indirect(reflect.ValueOf(ptr))
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("params: Pack(%T): want pointer to struct", ptr)
+	}
+	fs, _ := fields(v.Type()) // validate tags do not concern Pack
+	form := make(url.Values)
+	for _, f := range fs {
+		if f.Type == fileType || f.Type == filesType {
+			continue
+		}
+		fv, ok := lookup(v, f.index)
+		if !ok || f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		if isList(fv.Type()) {
+			for i := 0; i < fv.Len(); i++ {
+				if err := pack(form, f.name, fv.Index(i)); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if err := pack(form, f.name, fv); err != nil {
+			return nil, err
+		}
+	}
+	return form, nil
+}
+
+// URL returns base with the parameters packed from the struct pointed
+// to by ptr added to its query string, replacing any of the same name.
+func URL(base string, ptr interface{}) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	form, err := Pack(ptr)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	for name, values := range form {
+		query[name] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// lookup returns the nested field of struct v at index, and false if
+// a nil pointer to a struct on the way means there is none.
+func lookup(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// pack adds to form the parameter value of v, a single field or
+// element of a slice field, in the form that populate reads.
+func pack(form url.Values, name string, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Type() {
+	case timeType:
+		form.Add(name, v.Interface().(time.Time).Format(time.RFC3339Nano))
+		return nil
+	case durationType:
+		form.Add(name, time.Duration(v.Int()).String())
+		return nil
+	}
+	if v.Type().Implements(textMarshalerType) || v.CanAddr() && reflect.PtrTo(v.Type()).Implements(textMarshalerType) {
+		if v.CanAddr() {
+			v = v.Addr()
+		}
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		form.Add(name, string(text))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		form.Add(name, v.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		form.Add(name, strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		form.Add(name, strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		form.Add(name, strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()))
+	case reflect.Bool:
+		form.Add(name, strconv.FormatBool(v.Bool()))
+	default:
+		return fmt.Errorf("%s: unsupported kind %s", name, v.Type())
+	}
+	return nil
+}
@@ -1,73 +1,391 @@
-// Package main provides example of using params,
-// which provides a reflection-based parser for URL parameters.
-package main
+// Package params provides a reflection-based parser for URL parameters.
+package params
 
 import (
+	"encoding"
+	"encoding/json"
 	"fmt"
-	"log"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// maxMemory is the number of bytes of a multipart body kept in
+// memory, as for http.Request.FormValue; the rest go to disk.
+const maxMemory = 32 << 20
+
 // Unpack populates the fields of the struct pointed to by ptr
 // from the HTTP request parameters in req.
+//
+// Parameters are read from the query string and, depending on its
+// content type, from the request body: an URL-encoded or multipart
+// form, or a JSON object, whose members are matched like parameters
+// of the same name, nested objects giving dotted names, and whose
+// arrays supply a parameter several times. Body parameters come
+// before those of the query string.
+//
+// A field's parameter is named by its `http:"name"` tag or, lacking
+// one, its lowercased name; fields tagged `http:"-"` and unexported
+// fields are ignored. The fields of a nested struct, or pointer to
+// struct, are named after it with a dot, as in "page.size", except
+// that those of an embedded struct without a tag are promoted.
+//
+// Strings, bools and all integer and floating-point kinds are
+// supported, as are time.Duration, written as for time.ParseDuration,
+// time.Time, written in RFC 3339 format or as a date 2006-01-02, and
+// types that implement encoding.TextUnmarshaler. A slice field gets
+// a value appended for each occurrence of its parameter; otherwise
+// the last occurrence wins. A pointer field is allocated only when
+// its parameter is present, so it can tell an omitted parameter from
+// a zero one. Fields of type *multipart.FileHeader or a slice of them
+// receive the files uploaded under their name in a multipart body.
+//
+// Parameters are then checked against the comma-separated constraints
+// in the field's validate tag, as in `validate:"required,max=100"`:
+//
+//	required     the parameter must have a non-empty value
+//	min=n        a number or duration must be at least n, a string at
+//	             least n characters long, and a slice have at least n
+//	             elements
+//	max=n        likewise, at most n
+//	email        a string must be an e-mail address, such as a@b.org
+//	oneof=a b c  the value must be one of those listed
+//	regexp=re    a string must match re, which runs to the end of the tag
+//
+// Except for required, constraints apply only to parameters that are
+// present, and those other than min and max to each element of a slice.
+// If any parameter is malformed or invalid, Unpack carries on with the
+// others and returns an Errors listing them all, so that a client can
+// be told of every mistake at once.
 func Unpack(req *http.Request, ptr interface{}) error {
-	if err := req.ParseForm(); err != nil {
+	form, files, err := parse(req)
+	if err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("params: Unpack(%T): want non-nil pointer to struct", ptr)
+	}
+	v = v.Elem() // the struct variable
+
+	fs, err := fields(v.Type())
+	if err != nil {
 		return err
 	}
 
-	// Build map of fields keyed by effective name.
-	fields := make(map[string]reflect.Value)
-	v := reflect.ValueOf(ptr).Elem() // the struct variable
-	for i := 0; i < v.NumField(); i++ {
-		fieldInfo := v.Type().Field(i) // a reflect.StructField
-		tag := fieldInfo.Tag           // a reflect.StructTag
-		name := tag.Get("http")
+	// Update struct field for each parameter in the request,
+	// collecting every malformed or invalid one.
+	errs := make(Errors)
+	for _, f := range fs {
+		fv, present, err := unpackField(v, f, form, files)
+		if err != nil {
+			errs.add(f.name, err.Error())
+			continue
+		}
+		for _, msg := range validate(fv, present, f.rules) {
+			errs.add(f.name, msg)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// unpackField sets field f of struct v from its parameter, if present,
+// and returns the field and whether the parameter had a non-empty value.
+func unpackField(v reflect.Value, f field, form url.Values, files map[string][]*multipart.FileHeader) (reflect.Value, bool, error) {
+	if f.Type == fileType || f.Type == filesType {
+		hs := files[f.name]
+		if len(hs) == 0 {
+			return reflect.Value{}, false, nil
+		}
+		fv := fieldByIndex(v, f.index)
+		if f.Type == fileType {
+			fv.Set(reflect.ValueOf(hs[len(hs)-1]))
+		} else {
+			fv.Set(reflect.AppendSlice(fv, reflect.ValueOf(hs)))
+		}
+		return fv, true, nil
+	}
+	values := form[f.name]
+	if len(values) == 0 {
+		return reflect.Value{}, false, nil
+	}
+	fv := fieldByIndex(v, f.index)
+	present := false
+	for _, value := range values {
+		present = present || value != ""
+		if isList(fv.Type()) {
+			elem := reflect.New(fv.Type().Elem()).Elem()
+			if err := populate(elem, value); err != nil {
+				return fv, present, err
+			}
+			fv.Set(reflect.Append(fv, elem))
+		} else {
+			if err := populate(fv, value); err != nil {
+				return fv, present, err
+			}
+		}
+	}
+	return fv, present, nil
+}
+
+// parse returns the parameters of req, and any files uploaded in
+// a multipart body, as described at Unpack.
+func parse(req *http.Request) (url.Values, map[string][]*multipart.FileHeader, error) {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch mediaType {
+	case "multipart/form-data":
+		if err := req.ParseMultipartForm(maxMemory); err != nil {
+			return nil, nil, err
+		}
+		return req.Form, req.MultipartForm.File, nil
+
+	case "application/json":
+		if err := req.ParseForm(); err != nil { // the query string
+			return nil, nil, err
+		}
+		var body map[string]interface{}
+		dec := json.NewDecoder(req.Body)
+		dec.UseNumber()
+		if err := dec.Decode(&body); err != nil {
+			return nil, nil, fmt.Errorf("params: invalid JSON body: %v", err)
+		}
+		form := make(url.Values)
+		flatten(form, "", body)
+		for name, values := range req.Form {
+			form[name] = append(form[name], values...)
+		}
+		return form, nil, nil
+	}
+	if err := req.ParseForm(); err != nil {
+		return nil, nil, err
+	}
+	return req.Form, nil, nil
+}
+
+// flatten adds to form the parameters given by the JSON value x
+// for the parameter name.
+func flatten(form url.Values, name string, x interface{}) {
+	switch x := x.(type) {
+	case map[string]interface{}:
+		for key, elem := range x {
+			if name != "" {
+				key = name + "." + key
+			}
+			flatten(form, key, elem)
+		}
+	case []interface{}:
+		for _, elem := range x {
+			flatten(form, name, elem)
+		}
+	case string:
+		form.Add(name, x)
+	case json.Number:
+		form.Add(name, x.String())
+	case bool:
+		form.Add(name, strconv.FormatBool(x))
+	} // null supplies no value
+}
+
+// A field is a struct field, perhaps of a nested struct,
+// that receives a parameter.
+type field struct {
+	reflect.StructField
+	name      string // effective parameter name
+	index     []int  // as for reflect.Value.FieldByIndex
+	omitEmpty bool   // for Pack
+	rules     []rule // from the validate tag
+}
+
+// A structInfo records the fields of a struct type, or the error in
+// one of their validate tags.
+type structInfo struct {
+	fields []field
+	err    error
+}
+
+var structInfos sync.Map // map[reflect.Type]*structInfo
+
+// fields returns the fields of struct type t that receive parameters,
+// with the constraints of their validate tags. As this is the same on
+// every call, and the regexps in the tags are costly to compile, the
+// result is computed once for each type. An error reports an invalid
+// validate tag, which is a mistake in the program.
+func fields(t reflect.Type) ([]field, error) {
+	if info, ok := structInfos.Load(t); ok {
+		return info.(*structInfo).fields, info.(*structInfo).err
+	}
+	info := &structInfo{fields: appendFields(nil, t, "", nil, map[reflect.Type]bool{t: true})}
+	for i := range info.fields {
+		rules, err := parseRules(info.fields[i])
+		if err != nil {
+			info.err = err
+			break
+		}
+		info.fields[i].rules = rules
+	}
+	actual, _ := structInfos.LoadOrStore(t, info)
+	return actual.(*structInfo).fields, actual.(*structInfo).err
+}
+
+// appendFields appends to fs the fields of struct type t, whose
+// parameters are named with prefix, at index within the outermost
+// struct. The structs being expanded are marked in outer so that a
+// recursive type such as a linked list does not recurse forever.
+func appendFields(fs []field, t reflect.Type, prefix string, index []int, outer map[reflect.Type]bool) []field {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous { // unexported
+			continue
+		}
+		tag := sf.Tag.Get("http")
+		if tag == "-" {
+			continue
+		}
+		tag, opts, _ := strings.Cut(tag, ",")
+		name := tag
 		if name == "" {
-			name = strings.ToLower(fieldInfo.Name)
-		}
-		fields[name] = v.Field(i)
-	}
-
-	// Update struct field for each parameter in the request.
-	for name, values := range req.Form {
-		f := fields[name]
-		if !f.IsValid() {
-			continue // ignore unrecognized HTTP parameters
-		}
-		for _, value := range values {
-			if f.Kind() == reflect.Slice {
-				elem := reflect.New(f.Type().Elem()).Elem()
-				if err := populate(elem, value); err != nil {
-					return fmt.Errorf("%s: %v", name, err)
-				}
-				f.Set(reflect.Append(f, elem))
-			} else {
-				if err := populate(f, value); err != nil {
-					return fmt.Errorf("%s: %v", name, err)
-				}
+			name = strings.ToLower(sf.Name)
+		}
+		name = prefix + name
+		idx := append(append([]int(nil), index...), i)
+
+		if st := nestedStruct(sf.Type); st != nil {
+			if outer[st] || sf.PkgPath != "" && sf.Type.Kind() == reflect.Ptr {
+				continue // recursive, or cannot be allocated
 			}
+			p := name + "."
+			if sf.Anonymous && tag == "" {
+				p = prefix
+			}
+			outer[st] = true
+			fs = appendFields(fs, st, p, idx, outer)
+			delete(outer, st)
+			continue
+		}
+		if sf.PkgPath != "" { // embedded non-struct of unexported type
+			continue
 		}
+		fs = append(fs, field{sf, name, idx, opts == "omitempty", nil})
 	}
-	return nil
+	return fs
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	fileType            = reflect.TypeOf((*multipart.FileHeader)(nil))
+	filesType           = reflect.TypeOf([]*multipart.FileHeader(nil))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// nestedStruct returns the struct type whose fields receive
+// parameters in place of a field of type t, if t is a struct or
+// pointer to struct, or nil if the field receives one itself.
+func nestedStruct(t reflect.Type) reflect.Type {
+	if t == fileType {
+		return nil
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType ||
+		reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return nil
+	}
+	return t
+}
+
+// isList reports whether a field of type t receives each occurrence
+// of its parameter as an element, rather than as a whole, as does a
+// net.IP, which is a slice but also a TextUnmarshaler.
+func isList(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && !reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// fieldByIndex returns the nested field of struct v at index,
+// allocating any nil pointers to structs on the way.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
 }
 
 // populate takes care of setting a single field v,
-// or a single element of a slice field from  a param value.
+// or a single element of a slice field from a param value.
 func populate(v reflect.Value, value string) error {
+	if v.Kind() == reflect.Ptr {
+		p := reflect.New(v.Type().Elem())
+		if err := populate(p.Elem(), value); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	switch v.Type() {
+	case timeType:
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			var err2 error
+			if t, err2 = time.Parse("2006-01-02", value); err2 != nil {
+				return err
+			}
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+
 	switch v.Kind() {
 	case reflect.String:
 		v.SetString(value)
 
-	case reflect.Int:
-		i, err := strconv.ParseInt(value, 10, 64)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, v.Type().Bits())
 		if err != nil {
 			return err
 		}
 		v.SetInt(i)
 
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+
 	case reflect.Bool:
 		b, err := strconv.ParseBool(value)
 		if err != nil {
@@ -80,48 +398,3 @@ func populate(v reflect.Value, value string) error {
 	}
 	return nil
 }
-
-/*
- * Example usage
- */
-
-// search implements the /search URL endpoint.
-func search(resp http.ResponseWriter, req *http.Request) {
-	var data struct {
-		Labels     []string `http:"l"`
-		MaxResults int      `http:"max"`
-		Exact      bool     `http:"x"`
-	}
-	data.MaxResults = 10 // set default
-	if err := Unpack(req, &data); err != nil {
-		http.Error(resp, err.Error(), http.StatusBadRequest) // 400
-		return
-	}
-
-	// ...rest of handler...
-	fmt.Fprintf(resp, "Search: %+v\n", data)
-}
-
-//!-
-
-func main() {
-	http.HandleFunc("/search", search)
-	log.Fatal(http.ListenAndServe(":12345", nil))
-}
-
-/*
-$ go build gopl.io/ch12/search
-$ ./search &
-$ ./fetch 'http://localhost:12345/search'
-Search: {Labels:[] MaxResults:10 Exact:false}
-$ ./fetch 'http://localhost:12345/search?l=golang&l=programming'
-Search: {Labels:[golang programming] MaxResults:10 Exact:false}
-$ ./fetch 'http://localhost:12345/search?l=golang&l=programming&max=100'
-Search: {Labels:[golang programming] MaxResults:100 Exact:false}
-$ ./fetch 'http://localhost:12345/search?x=true&l=golang&l=programming'
-Search: {Labels:[golang programming] MaxResults:10 Exact:true}
-$ ./fetch 'http://localhost:12345/search?q=hello&x=123'
-x: strconv.ParseBool: parsing "123": invalid syntax
-$ ./fetch 'http://localhost:12345/search?q=hello&max=lots'
-max: strconv.ParseInt: parsing "lots": invalid syntax
-*/
\ No newline at end of file
@@ -0,0 +1,347 @@
+package params
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type page struct {
+	Size   int `http:"size"`
+	Number uint16
+}
+
+type query struct {
+	Labels  []string `http:"l"`
+	Max     int8     `http:"max"`
+	Ratio   float32
+	Exact   bool `http:"x"`
+	Since   time.Time
+	Timeout time.Duration
+	IP      net.IP
+	Limit   *int
+	Page    page
+	Next    *page
+	Ignored string `http:"-"`
+	hidden  string
+	embedded
+}
+
+type embedded struct {
+	Lang string
+}
+
+func TestUnpack(t *testing.T) {
+	req := httptest.NewRequest("GET", "/search?l=golang&l=programming&max=-5&ratio=0.5&x=true"+
+		"&since=2024-03-01&timeout=1m30s&ip=10.0.0.1&limit=0&page.size=20&page.number=3"+
+		"&next.size=7&ignored=x&hidden=x&lang=go&unknown=1", nil)
+	var got query
+	if err := Unpack(req, &got); err != nil {
+		t.Fatal(err)
+	}
+	zero := 0
+	want := query{
+		Labels:   []string{"golang", "programming"},
+		Max:      -5,
+		Ratio:    0.5,
+		Exact:    true,
+		Since:    time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		Timeout:  90 * time.Second,
+		IP:       net.ParseIP("10.0.0.1"),
+		Limit:    &zero,
+		Page:     page{20, 3},
+		Next:     &page{Size: 7},
+		embedded: embedded{"go"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unpack:\n got %+v\nwant %+v", got, want)
+	}
+
+	// Omitted pointers stay nil.
+	var q query
+	if err := Unpack(httptest.NewRequest("GET", "/search", nil), &q); err != nil {
+		t.Fatal(err)
+	}
+	if q.Limit != nil || q.Next != nil {
+		t.Errorf("Unpack allocated omitted pointers: %v, %v", q.Limit, q.Next)
+	}
+}
+
+func TestUnpackErrors(t *testing.T) {
+	for _, test := range []struct{ query, want string }{
+		{"max=300", `max: strconv.ParseInt: parsing "300": value out of range`},
+		{"page.number=-1", `page.number: strconv.ParseUint: parsing "-1": invalid syntax`},
+		{"x=123", `x: strconv.ParseBool: parsing "123": invalid syntax`},
+		{"since=yesterday", `since: parsing time "yesterday" as "2006-01-02T15:04:05Z07:00": cannot parse "yesterday" as "2006"`},
+		{"ip=nowhere", `ip: invalid IP address: nowhere`},
+	} {
+		var q query
+		err := Unpack(httptest.NewRequest("GET", "/search?"+test.query, nil), &q)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("Unpack(%s) = %v, want %s", test.query, err, test.want)
+		}
+	}
+}
+
+func TestUnpackBody(t *testing.T) {
+	// A JSON body, with the query string taking precedence.
+	body := `{"l": ["a", "b"], "max": 3, "x": true, "page": {"size": 9}, "limit": null}`
+	req := httptest.NewRequest("POST", "/search?max=4", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	var q query
+	if err := Unpack(req, &q); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(q.Labels, []string{"a", "b"}) || q.Max != 4 || !q.Exact ||
+		q.Page.Size != 9 || q.Limit != nil {
+		t.Errorf("Unpack(JSON) = %+v", q)
+	}
+
+	// An URL-encoded form.
+	req = httptest.NewRequest("POST", "/search", strings.NewReader("l=c&max=5"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	q = query{}
+	if err := Unpack(req, &q); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(q.Labels, []string{"c"}) || q.Max != 5 {
+		t.Errorf("Unpack(form) = %+v", q)
+	}
+
+	// A multipart form with files.
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	w.WriteField("max", "6")
+	for _, name := range []string{"a.txt", "b.txt"} {
+		fw, _ := w.CreateFormFile("attachments", name)
+		fw.Write([]byte("contents of " + name))
+	}
+	w.Close()
+	req = httptest.NewRequest("POST", "/upload", &buf)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	var upload struct {
+		Max         int
+		Attachments []*multipart.FileHeader
+		Last        *multipart.FileHeader `http:"attachments"`
+	}
+	if err := Unpack(req, &upload); err != nil {
+		t.Fatal(err)
+	}
+	if upload.Max != 6 || len(upload.Attachments) != 2 || upload.Last == nil || upload.Last.Filename != "b.txt" {
+		t.Errorf("Unpack(multipart) = %+v", upload)
+	}
+
+	req = httptest.NewRequest("POST", "/search", strings.NewReader(`["not", "an", "object"]`))
+	req.Header.Set("Content-Type", "application/json")
+	if err := Unpack(req, &q); err == nil {
+		t.Errorf("Unpack(JSON array) succeeded, want error")
+	}
+}
+
+func TestRecursiveType(t *testing.T) {
+	type node struct {
+		Value int
+		Next  *node
+	}
+	var n node
+	req := httptest.NewRequest(http.MethodGet, "/?value=1&next.value=2", nil)
+	if err := Unpack(req, &n); err != nil {
+		t.Fatal(err)
+	}
+	if n.Value != 1 || n.Next != nil {
+		t.Errorf("Unpack = %+v, want only Value set", n)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	type form struct {
+		Name  string         `validate:"required,min=2,max=5"`
+		Email string         `validate:"email"`
+		Sort  string         `validate:"oneof=asc desc"`
+		Max   int            `validate:"min=1,max=100"`
+		Wait  *time.Duration `validate:"max=1m"`
+		Tags  []string       `http:"tag" validate:"max=2,regexp=^[a-z]+$"`
+		Code  string         `validate:"regexp=^[A-Z]{2,3}$"`
+	}
+	tests := []struct {
+		query string
+		want  Errors
+	}{
+		{"name=bob&email=bob@example.com&sort=asc&max=10&wait=30s&tag=a&tag=b&code=ABC", nil},
+		{"max=0", Errors{"name": {"is required"}, "max": {"must be at least 1"}}},
+		{"name=b&max=101&wait=2m", Errors{
+			"name": {"must be at least 2 characters long"},
+			"max":  {"must be at most 100"},
+			"wait": {"must be at most 1m"},
+		}},
+		{"name=&email=Bob <bob@example.com>&sort=up", Errors{
+			"name":  {"is required"},
+			"email": {"must be an e-mail address"},
+			"sort":  {"must be one of asc, desc"},
+		}},
+		{"name=bob&tag=a&tag=B&tag=c&code=a,b", Errors{
+			"tag":  {"must have at most 2 values", "must match ^[a-z]+$"},
+			"code": {"must match ^[A-Z]{2,3}$"},
+		}},
+		{"name=bob&max=many&wait=soon", Errors{
+			"max":  {`strconv.ParseInt: parsing "many": invalid syntax`},
+			"wait": {`time: invalid duration "soon"`},
+		}},
+	}
+	for _, test := range tests {
+		var f form
+		req := httptest.NewRequest("GET", "/?"+strings.ReplaceAll(test.query, " ", "+"), nil)
+		err := Unpack(req, &f)
+		var got Errors
+		if err != nil {
+			var ok bool
+			if got, ok = err.(Errors); !ok {
+				t.Errorf("Unpack(%s) = %v (%T), want Errors", test.query, err, err)
+				continue
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Unpack(%s):\n got %v\nwant %v", test.query, got, test.want)
+		}
+	}
+
+	var bad struct {
+		Flag bool `validate:"min=1"`
+	}
+	for i := 0; i < 2; i++ { // the second time, from the cache
+		err := Unpack(httptest.NewRequest("GET", "/", nil), &bad)
+		if _, ok := err.(Errors); ok || err == nil {
+			t.Errorf("Unpack with invalid tag = %v, want program error", err)
+		}
+	}
+}
+
+func TestPack(t *testing.T) {
+	limit := 0
+	in := query{
+		Labels:   []string{"golang", "programming & more"},
+		Max:      -5,
+		Ratio:    0.1,
+		Exact:    true,
+		Since:    time.Date(2024, 3, 1, 12, 30, 0, 5, time.UTC),
+		Timeout:  90 * time.Second,
+		IP:       net.ParseIP("10.0.0.1"),
+		Limit:    &limit,
+		Page:     page{20, 3},
+		Next:     &page{Size: 7},
+		embedded: embedded{"go"},
+	}
+	link, err := URL("/search?lang=en&q=x", &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out query
+	if err := Unpack(httptest.NewRequest("GET", link, nil), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("Unpack(URL(x)) = %+v, want %+v\nURL: %s", out, in, link)
+	}
+	if !strings.Contains(link, "q=x") {
+		t.Errorf("URL dropped base parameter: %s", link)
+	}
+
+	// Nil pointers, empty slices and empty omitempty fields are left out.
+	var opt struct {
+		Labels []string `http:"l"`
+		Max    int      `http:"max,omitempty"`
+		Exact  bool     `http:"x"`
+		Limit  *int
+		Next   *page
+	}
+	form, err := Pack(&opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := form.Encode(), "x=false"; got != want {
+		t.Errorf("Pack(%+v) = %s, want %s", opt, got, want)
+	}
+}
+
+func TestParameters(t *testing.T) {
+	type params struct {
+		Labels []string      `http:"l" validate:"required,min=1,max=5,oneof=go c"`
+		Max    uint8         `http:"max" validate:"max=100"`
+		Sort   string        `validate:"oneof=asc desc,min=3"`
+		Email  *string       `validate:"email"`
+		Ratio  float64       `validate:"min=0.5"`
+		Wait   time.Duration `validate:"max=1m"`
+		Page   page
+	}
+	proto := params{Labels: []string{"go"}, Max: 10, Sort: "asc", Wait: time.Second}
+	ps, err := Parameters(&proto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[` +
+		`{"name":"l","in":"query","required":true,"schema":{"type":"array","items":{"type":"string","enum":["go","c"]},"default":["go"],"minItems":1,"maxItems":5}},` +
+		`{"name":"max","in":"query","schema":{"type":"integer","format":"int32","default":10,"minimum":0,"maximum":100}},` +
+		`{"name":"sort","in":"query","schema":{"type":"string","default":"asc","enum":["asc","desc"],"minLength":3}},` +
+		`{"name":"email","in":"query","schema":{"type":"string","format":"email"}},` +
+		`{"name":"ratio","in":"query","schema":{"type":"number","format":"double","minimum":0.5}},` +
+		`{"name":"wait","in":"query","schema":{"type":"string","format":"duration","default":"1s"}},` +
+		`{"name":"page.size","in":"query","schema":{"type":"integer","format":"int64"}},` +
+		`{"name":"page.number","in":"query","schema":{"type":"integer","format":"int32","minimum":0}}]`
+	if string(data) != want {
+		t.Errorf("Parameters:\n got %s\nwant %s", data, want)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	r := NewRouter("Test", "1.0")
+	r.HandleFunc("GET", "/search", "Search", &page{Size: 10}, func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("searched"))
+	})
+
+	for _, test := range []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{"GET", "/search", 200, "searched"},
+		{"POST", "/search", 405, "method not allowed\n"},
+		{"GET", "/nowhere", 404, "404 page not found\n"},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+		if w.Code != test.code || w.Body.String() != test.body {
+			t.Errorf("%s %s = %d %q, want %d %q",
+				test.method, test.path, w.Code, w.Body, test.code, test.body)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", SpecPath, nil))
+	var doc Document
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	op := doc.Paths["/search"]["get"]
+	if doc.OpenAPI != "3.0.3" || doc.Info.Title != "Test" || op == nil || len(op.Parameters) != 2 ||
+		op.Parameters[0].Name != "size" || op.Parameters[0].Schema.Default != 10.0 {
+		t.Errorf("spec = %s", w.Body)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("duplicate registration did not panic")
+		}
+	}()
+	r.Handle("GET", "/search", "", &page{}, http.NotFoundHandler())
+}
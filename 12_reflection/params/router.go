@@ -0,0 +1,100 @@
+package params
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// SpecPath is the path at which a Router serves its OpenAPI document.
+const SpecPath = "/openapi.json"
+
+// A Router is an http.Handler that dispatches requests by path and
+// method to handlers registered together with the type of their
+// parameters, from which it describes the API in an OpenAPI document.
+// Paths are matched exactly.
+type Router struct {
+	handlers map[string]map[string]http.Handler // path, then method
+	spec     Document
+}
+
+// NewRouter returns a router for the API with the given title and version.
+func NewRouter(title, version string) *Router {
+	return &Router{
+		handlers: make(map[string]map[string]http.Handler),
+		spec: Document{
+			OpenAPI: "3.0.3",
+			Info:    Info{title, version},
+			Paths:   make(map[string]map[string]*Operation),
+		},
+	}
+}
+
+// Handle registers handler for requests with the given method and
+// path, whose parameters the handler unpacks into a struct like the
+// one pointed to by params, as described at Parameters.
+// Handle panics if the method is already registered for the path or
+// if params has an invalid validate tag, as these are program errors.
+func (r *Router) Handle(method, path, summary string, params interface{}, handler http.Handler) {
+	method = strings.ToUpper(method)
+	if r.handlers[path][method] != nil {
+		panic(fmt.Sprintf("params: multiple registrations for %s %s", method, path))
+	}
+	ps, err := Parameters(params)
+	if err != nil {
+		panic(err)
+	}
+	if r.handlers[path] == nil {
+		r.handlers[path] = make(map[string]http.Handler)
+		r.spec.Paths[path] = make(map[string]*Operation)
+	}
+	r.handlers[path][method] = handler
+	r.spec.Paths[path][strings.ToLower(method)] = &Operation{
+		Summary:    summary,
+		Parameters: ps,
+		Responses: map[string]Response{
+			"200": {"OK"},
+			"400": {"Invalid parameters"},
+		},
+	}
+}
+
+// HandleFunc registers the handler function for the given method and path.
+func (r *Router) HandleFunc(method, path, summary string, params interface{}, handler func(http.ResponseWriter, *http.Request)) {
+	r.Handle(method, path, summary, params, http.HandlerFunc(handler))
+}
+
+// Spec returns the OpenAPI document describing the registered handlers.
+func (r *Router) Spec() *Document { return &r.spec }
+
+// ServeHTTP dispatches the request to the handler registered for its
+// path and method, and serves the OpenAPI document at SpecPath unless
+// a handler is registered there.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	methods := r.handlers[req.URL.Path]
+	if methods == nil {
+		if req.URL.Path == SpecPath && req.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/json")
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			enc.Encode(r.spec)
+			return
+		}
+		http.NotFound(w, req)
+		return
+	}
+	h := methods[req.Method]
+	if h == nil {
+		var allow []string
+		for method := range methods {
+			allow = append(allow, method)
+		}
+		sort.Strings(allow)
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed) // 405
+		return
+	}
+	h.ServeHTTP(w, req)
+}
@@ -0,0 +1,102 @@
+// Search is an example of using params, which provides
+// a reflection-based parser for URL parameters.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"gopl.io/ch12/params"
+)
+
+// searchParams are the parameters of the /search URL endpoint.
+type searchParams struct {
+	Labels     []string      `http:"l" validate:"max=5,regexp=^[a-z]+$"`
+	MaxResults int           `http:"max" validate:"min=1,max=100"`
+	Exact      bool          `http:"x"`
+	Since      *time.Time    `http:"since"`
+	Timeout    time.Duration `http:"timeout" validate:"max=10s"`
+}
+
+// searchDefaults holds the default parameters, which
+// are also published in the API description.
+var searchDefaults = searchParams{MaxResults: 10}
+
+// search implements the /search URL endpoint.
+func search(resp http.ResponseWriter, req *http.Request) {
+	data := searchDefaults // set defaults
+	if err := params.Unpack(req, &data); err != nil {
+		var errs params.Errors
+		if !errors.As(err, &errs) {
+			http.Error(resp, err.Error(), http.StatusBadRequest) // 400
+			return
+		}
+		// List every invalid parameter for the client.
+		resp.Header().Set("Content-Type", "application/json")
+		resp.WriteHeader(http.StatusBadRequest) // 400
+		json.NewEncoder(resp).Encode(struct {
+			Errors params.Errors `json:"errors"`
+		}{errs})
+		return
+	}
+
+	// ...rest of handler...
+	fmt.Fprintf(resp, "Search: %+v\n", data)
+}
+
+func main() {
+	r := params.NewRouter("Search", "1.0")
+	r.HandleFunc("GET", "/search", "Search by label", &searchDefaults, search)
+	log.Fatal(http.ListenAndServe(":12345", r))
+}
+
+/*
+$ go build gopl.io/ch12/params/search
+$ ./search &
+$ ./fetch 'http://localhost:12345/search'
+Search: {Labels:[] MaxResults:10 Exact:false Since:<nil> Timeout:0s}
+$ ./fetch 'http://localhost:12345/search?l=golang&l=programming'
+Search: {Labels:[golang programming] MaxResults:10 Exact:false Since:<nil> Timeout:0s}
+$ ./fetch 'http://localhost:12345/search?l=golang&l=programming&max=100'
+Search: {Labels:[golang programming] MaxResults:100 Exact:false Since:<nil> Timeout:0s}
+$ ./fetch 'http://localhost:12345/search?x=true&l=golang&l=programming'
+Search: {Labels:[golang programming] MaxResults:10 Exact:true Since:<nil> Timeout:0s}
+$ ./fetch 'http://localhost:12345/search?q=hello&x=123'
+{"errors":{"x":["strconv.ParseBool: parsing \"123\": invalid syntax"]}}
+$ ./fetch 'http://localhost:12345/search?q=hello&max=lots'
+{"errors":{"max":["strconv.ParseInt: parsing \"lots\": invalid syntax"]}}
+$ ./fetch 'http://localhost:12345/search?l=Go&max=500&timeout=1m'
+{"errors":{"l":["must match ^[a-z]+$"],"max":["must be at most 100"],"timeout":["must be at most 10s"]}}
+$ curl -d '{"l": ["golang"], "timeout": "2s"}' -H 'Content-Type: application/json' \
+	'http://localhost:12345/search?max=5'
+Search: {Labels:[golang] MaxResults:5 Exact:false Since:<nil> Timeout:2s}
+$ ./fetch 'http://localhost:12345/openapi.json'
+{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "Search",
+    "version": "1.0"
+  },
+  "paths": {
+    "/search": {
+      "get": {
+        "summary": "Search by label",
+        "parameters": [
+          ...
+          {
+            "name": "max",
+            "in": "query",
+            "schema": {
+              "type": "integer",
+              "format": "int64",
+              "default": 10,
+              "minimum": 1,
+              "maximum": 100
+            }
+          },
+          ...
+*/
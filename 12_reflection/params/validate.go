@@ -0,0 +1,220 @@
+package params
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Errors describes the parameters that Unpack found to be malformed
+// or in violation of their constraints. It maps each parameter name
+// to a list of messages, such as "must be at most 100", and so can be
+// reported to a client as a JSON object.
+type Errors map[string][]string
+
+func (errs Errors) add(name, msg string) {
+	errs[name] = append(errs[name], msg)
+}
+
+func (errs Errors) Error() string {
+	names := make([]string, 0, len(errs))
+	for name := range errs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		for _, msg := range errs[name] {
+			if b.Len() > 0 {
+				b.WriteString("; ")
+			}
+			fmt.Fprintf(&b, "%s: %s", name, msg)
+		}
+	}
+	return b.String()
+}
+
+// A rule is one constraint of a validate tag.
+type rule struct {
+	name  string // required, min, max, email, oneof or regexp
+	arg   string
+	limit float64        // for min and max
+	re    *regexp.Regexp // for regexp
+}
+
+// parseRules parses the validate tag of field f, checking that each
+// constraint applies to the field's type. An invalid tag is an error
+// in the program rather than the request and is reported as such.
+func parseRules(f field) ([]rule, error) {
+	tag := f.Tag.Get("validate")
+	if tag == "" {
+		return nil, nil
+	}
+	t := f.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	elem := t // the type to which rules other than min and max apply
+	if isList(t) {
+		elem = t.Elem()
+		if elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+	}
+
+	var rules []rule
+	for tag != "" {
+		var r rule
+		if strings.HasPrefix(tag, "regexp=") {
+			r.name, r.arg, tag = "regexp", tag[len("regexp="):], ""
+		} else {
+			var item string
+			item, tag, _ = strings.Cut(tag, ",")
+			r.name, r.arg, _ = strings.Cut(item, "=")
+		}
+		bad := func(format string, args ...interface{}) ([]rule, error) {
+			return nil, fmt.Errorf("params: field %s: invalid validate constraint %q: %s",
+				f.Name, r.name, fmt.Sprintf(format, args...))
+		}
+
+		switch r.name {
+		case "required":
+		case "min", "max":
+			var err error
+			switch {
+			case t == durationType:
+				var d time.Duration
+				d, err = time.ParseDuration(r.arg)
+				r.limit = float64(d)
+			case isList(t) || t.Kind() == reflect.String || isNumber(t):
+				r.limit, err = strconv.ParseFloat(r.arg, 64)
+			default:
+				return bad("not applicable to %s", f.Type)
+			}
+			if err != nil {
+				return bad("%v", err)
+			}
+		case "email":
+			if elem.Kind() != reflect.String {
+				return bad("not applicable to %s", f.Type)
+			}
+		case "oneof":
+			if r.arg == "" {
+				return bad("no values")
+			}
+		case "regexp":
+			if elem.Kind() != reflect.String {
+				return bad("not applicable to %s", f.Type)
+			}
+			var err error
+			if r.re, err = regexp.Compile(r.arg); err != nil {
+				return bad("%v", err)
+			}
+		default:
+			return bad("unknown constraint")
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func isNumber(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// validate returns a message for each of the rules that the field v
+// breaks, given whether its parameter was present.
+func validate(v reflect.Value, present bool, rules []rule) []string {
+	var msgs []string
+	for _, r := range rules {
+		if r.name == "required" {
+			if !present {
+				msgs = append(msgs, "is required")
+			}
+			continue
+		}
+		if !present {
+			continue
+		}
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		if isList(v.Type()) && r.name != "min" && r.name != "max" {
+			for i := 0; i < v.Len(); i++ {
+				if msg := r.check(reflect.Indirect(v.Index(i))); msg != "" {
+					msgs = append(msgs, msg)
+					break
+				}
+			}
+		} else if msg := r.check(v); msg != "" {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+// check returns a message if v breaks rule r, or "" if not.
+func (r rule) check(v reflect.Value) string {
+	switch r.name {
+	case "min", "max":
+		var x float64
+		verb, what := "be", ""
+		switch {
+		case isList(v.Type()):
+			x, verb, what = float64(v.Len()), "have", " values"
+		case v.Kind() == reflect.String:
+			x, what = float64(utf8.RuneCountInString(v.String())), " characters long"
+		case v.Type() == durationType:
+			x = float64(v.Int())
+		default:
+			x = number(v)
+		}
+		if r.name == "min" && x < r.limit {
+			return "must " + verb + " at least " + r.arg + what
+		}
+		if r.name == "max" && x > r.limit {
+			return "must " + verb + " at most " + r.arg + what
+		}
+	case "email":
+		addr, err := mail.ParseAddress(v.String())
+		if err != nil || addr.Name != "" || addr.Address != v.String() {
+			return "must be an e-mail address"
+		}
+	case "oneof":
+		s := fmt.Sprint(v.Interface())
+		for _, choice := range strings.Fields(r.arg) {
+			if s == choice {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(strings.Fields(r.arg), ", ")
+	case "regexp":
+		if !r.re.MatchString(v.String()) {
+			return "must match " + r.arg
+		}
+	}
+	return ""
+}
+
+// number returns the value of v, a number, as a float64.
+func number(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
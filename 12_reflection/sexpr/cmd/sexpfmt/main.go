@@ -0,0 +1,83 @@
+// Sexpfmt reformats S-expression files in the layout produced by
+// sexpr.MarshalIndent. With no file arguments it reads standard input.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gopl.io/ch12/sexpr"
+)
+
+var (
+	width  = flag.Int("width", 80, "maximum line width")
+	indent = flag.Int("indent", 1, "indentation of list elements")
+	write  = flag.Bool("w", false, "write result to (source) file instead of stdout")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "sexpfmt: cannot use -w with standard input")
+			os.Exit(2)
+		}
+		src, err := io.ReadAll(os.Stdin)
+		if err == nil {
+			err = format("<stdin>", src, os.Stdout)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sexpfmt: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	exit := 0
+	for _, name := range flag.Args() {
+		if err := formatFile(name); err != nil {
+			fmt.Fprintf(os.Stderr, "sexpfmt: %v\n", err)
+			exit = 1
+		}
+	}
+	os.Exit(exit)
+}
+
+// formatFile reformats the named file, in place if -w is set.
+func formatFile(name string) error {
+	src, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	if !*write {
+		return format(name, src, os.Stdout)
+	}
+	var out bytes.Buffer
+	if err := format(name, src, &out); err != nil {
+		return err
+	}
+	return os.WriteFile(name, out.Bytes(), 0644)
+}
+
+// format writes src reformatted to out, reporting errors against name.
+func format(name string, src []byte, out io.Writer) error {
+	var buf bytes.Buffer
+	if err := sexpr.Indent(&buf, src, *indent, *width); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	_, err := out.Write(buf.Bytes())
+	return err
+}
+
+/*
+// Usage
+$ go build gopl.io/ch12/sexpr/cmd/sexpfmt
+$ echo '((Title "Dr. Strangelove") (Year 1964) (Oscars ("Best Actor (Nomin.)" "Best Adapted Screenplay (Nomin.)")))' |
+	./sexpfmt -width 50
+((Title "Dr. Strangelove")
+ (Year 1964)
+ (Oscars ("Best Actor (Nomin.)"
+          "Best Adapted Screenplay (Nomin.)")))
+*/
@@ -0,0 +1,93 @@
+// Sexpselect prints the sub-expressions of S-expression documents
+// selected by a path, as described at sexpr.Path. With no file
+// arguments it reads standard input.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gopl.io/ch12/sexpr"
+)
+
+var width = flag.Int("width", 0, "lay out matches within this width (0 prints each on one line)")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: sexpselect [-width n] path [file ...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	path, err := sexpr.ParsePath(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sexpselect: %v\n", err)
+		os.Exit(2)
+	}
+	if flag.NArg() == 1 {
+		if err := selectFrom("<stdin>", os.Stdin, path); err != nil {
+			fmt.Fprintf(os.Stderr, "sexpselect: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	exit := 0
+	for _, name := range flag.Args()[1:] {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sexpselect: %v\n", err)
+			exit = 1
+			continue
+		}
+		err = selectFrom(name, f, path)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sexpselect: %v\n", err)
+			exit = 1
+		}
+	}
+	os.Exit(exit)
+}
+
+// selectFrom prints the matches of path in r, reporting errors against name.
+func selectFrom(name string, r io.Reader, path *sexpr.Path) error {
+	err := path.Select(r, func(match []byte) error {
+		var out bytes.Buffer
+		if *width > 0 {
+			if err := sexpr.Indent(&out, match, 1, *width); err != nil {
+				return err
+			}
+		} else {
+			out.Write(match)
+			out.WriteByte('\n')
+		}
+		_, err := os.Stdout.Write(out.Bytes())
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
+
+/*
+// Usage
+$ go build gopl.io/ch12/sexpr/cmd/sexpselect
+$ cat strangelove.sexp
+((Title "Dr. Strangelove") (Year 1964)
+ (Actor (("Dr. Strangelove" "Peter Sellers") ("Gen. Buck Turgidson" "George C. Scott")))
+ (Oscars ("Best Actor (Nomin.)" "Best Picture (Nomin.)")))
+$ ./sexpselect '(Actor "Dr. Strangelove")' strangelove.sexp
+"Peter Sellers"
+$ ./sexpselect 'Oscars/*' strangelove.sexp
+"Best Actor (Nomin.)"
+"Best Picture (Nomin.)"
+$ ./sexpselect '(** Year)' strangelove.sexp
+1964
+*/
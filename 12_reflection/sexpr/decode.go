@@ -4,7 +4,9 @@ package sexpr
 
 import (
 	"bytes"
+	"encoding"
 	"fmt"
+	"io"
 	"reflect"
 	"strconv"
 	"text/scanner"
@@ -12,141 +14,845 @@ import (
 
 // Unmarshal parses S-expression data and populates the variable
 // whose address is in the non-nil pointer out.
-func Unmarshal(data []byte, out interface{}) (err error) {
-	lex := &lexer{scan: scanner.Scanner{Mode: scanner.GoTokens}}
-	lex.scan.Init(bytes.NewReader(data))
-	lex.next() // get the first token
-	defer func() {
-		// NOTE: this is not an example of ideal error handling.
-		if x := recover(); x != nil {
-			err = fmt.Errorf("error at %s: %v", lex.scan.Position, x)
-		}
-	}()
-	read(lex, reflect.ValueOf(out).Elem())
+//
+// Unmarshal never panics. Malformed input is reported as a
+// *SyntaxError, and well-formed input that does not fit the type
+// of the variable as an *UnmarshalTypeError; both carry the line
+// and column at which the problem was found. If an error occurs,
+// the variable may have been partially populated.
+func Unmarshal(data []byte, out interface{}) error {
+	dec := NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(out); err != nil {
+		if err == io.EOF {
+			return dec.lex.syntaxError("unexpected end of input")
+		}
+		return err
+	}
+	if err := dec.lex.peek(); err != nil {
+		return err
+	}
+	if dec.lex.token != scanner.EOF {
+		return dec.lex.syntaxError("unexpected %s after top-level value", dec.lex.describe())
+	}
 	return nil
 }
 
+// A Symbol is an unquoted identifier such as a struct field name.
+// Symbols decoded into an empty interface have this type.
+type Symbol string
+
+// A SyntaxError describes malformed S-expression input.
+type SyntaxError struct {
+	Msg          string
+	Line, Column int
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("sexpr: syntax error at %d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+// An UnmarshalTypeError describes an S-expression value that
+// cannot be stored in a Go variable of the given type.
+type UnmarshalTypeError struct {
+	Value        string // description of the S-expression value
+	Type         reflect.Type
+	Line, Column int
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	return fmt.Sprintf("sexpr: cannot decode %s into Go value of type %s at %d:%d",
+		e.Value, e.Type, e.Line, e.Column)
+}
+
+// An InvalidUnmarshalError describes an invalid argument to
+// Unmarshal, which must be a non-nil pointer.
+type InvalidUnmarshalError struct {
+	Type reflect.Type
+}
+
+func (e *InvalidUnmarshalError) Error() string {
+	if e.Type == nil {
+		return "sexpr: Unmarshal(nil)"
+	}
+	if e.Type.Kind() != reflect.Ptr {
+		return "sexpr: Unmarshal(non-pointer " + e.Type.String() + ")"
+	}
+	return "sexpr: Unmarshal(nil " + e.Type.String() + ")"
+}
+
 // lexer
 type lexer struct {
-	scan scanner.Scanner
-	token rune // the current token
+	scan    scanner.Scanner
+	token   rune // the current token, valid after peek
+	lit     string
+	pos     scanner.Position
+	err     error      // first error reported by scan
+	scanned bool       // token has been scanned but not consumed
+	ahead   *lookahead // token scanned after a '#' that began no label
+	labels  map[int]reflect.Value
+}
+
+// A lookahead is a token scanned before it is needed.
+type lookahead struct {
+	token rune
+	lit   string
+	pos   scanner.Position
+}
+
+// Datum labels #n= and #n#, which the lexer reads as single tokens.
+const (
+	labelDef rune = -(iota + 100)
+	labelRef
+)
+
+func newLexer(r io.Reader) *lexer {
+	lex := new(lexer)
+	lex.scan.Init(r)
+	lex.scan.Mode = scanner.GoTokens
+	lex.scan.Error = func(s *scanner.Scanner, msg string) {
+		if lex.err == nil {
+			pos := s.Position
+			if !pos.IsValid() {
+				pos = s.Pos()
+			}
+			lex.err = &SyntaxError{msg, pos.Line, pos.Column}
+		}
+	}
+	return lex
+}
+
+// peek scans the next token, unless the current one has not yet
+// been consumed, and reports any error the scanner encountered.
+func (lex *lexer) peek() error {
+	if lex.scanned {
+		return lex.err
+	}
+	lex.scanned = true
+	if a := lex.ahead; a != nil {
+		lex.token, lex.lit, lex.pos = a.token, a.lit, a.pos
+		lex.ahead = nil
+		return lex.err
+	}
+	lex.token, lex.lit, lex.pos = lex.scanToken()
+	if lex.token != '#' {
+		return lex.err
+	}
+	// A '#' followed by a number is a label; anything
+	// else, such as the C of #C(re im), is left for later.
+	tok, lit, pos := lex.scanToken()
+	if tok != scanner.Int {
+		lex.ahead = &lookahead{tok, lit, pos}
+		return lex.err
+	}
+	if _, err := strconv.Atoi(lit); err != nil && lex.err == nil {
+		lex.err = &SyntaxError{"invalid label #" + lit, pos.Line, pos.Column}
+	}
+	end, _, pos := lex.scanToken()
+	switch end {
+	case '=':
+		lex.token = labelDef
+	case '#':
+		lex.token = labelRef
+	default:
+		if lex.err == nil {
+			lex.err = &SyntaxError{fmt.Sprintf("got %s after #%s, want '=' or '#'",
+				scanner.TokenString(end), lit), pos.Line, pos.Column}
+		}
+	}
+	lex.lit = "#" + lit + string(end)
+	return lex.err
+}
+
+func (lex *lexer) scanToken() (rune, string, scanner.Position) {
+	tok := lex.scan.Scan()
+	pos := lex.scan.Position
+	if !pos.IsValid() { // at EOF
+		pos = lex.scan.Pos()
+	}
+	return tok, lex.scan.TokenText(), pos
 }
 
-func (lex *lexer) next() { lex.token = lex.scan.Scan() }
-func (lex *lexer) text() string { return lex.scan.TokenText() }
+// next consumes the current token. The following one is not scanned
+// until it is needed, so that a Decoder reading from a stream does
+// not wait for input beyond the end of the value it is decoding.
+func (lex *lexer) next() { lex.scanned = false }
 
-func (lex *lexer) consume(want rune) {
-	if lex.token != want { // NOTE: not good err handling
-		panic(fmt.Sprintf("got %q, want %q", lex.text(), want))
+func (lex *lexer) text() string { return lex.lit }
+
+// label returns the number n of the current token, #n= or #n#.
+func (lex *lexer) label() int {
+	n, _ := strconv.Atoi(lex.lit[1 : len(lex.lit)-1])
+	return n
+}
+
+func (lex *lexer) consume(want rune) error {
+	if err := lex.peek(); err != nil {
+		return err
+	}
+	if lex.token != want {
+		return lex.syntaxError("got %s, want %q", lex.describe(), want)
 	}
 	lex.next()
+	return nil
+}
+
+// describe returns a description of the current token for errors.
+func (lex *lexer) describe() string {
+	switch lex.token {
+	case scanner.EOF:
+		return "end of input"
+	case scanner.Ident:
+		return "symbol " + lex.text()
+	case scanner.Int, scanner.Float:
+		return "number " + lex.text()
+	case scanner.String, scanner.RawString:
+		return "string " + lex.text()
+	case labelDef, labelRef:
+		return "label " + lex.text()
+	}
+	return strconv.Quote(lex.text())
+}
+
+func (lex *lexer) syntaxError(format string, args ...interface{}) error {
+	return &SyntaxError{fmt.Sprintf(format, args...), lex.pos.Line, lex.pos.Column}
+}
+
+func (lex *lexer) typeError(value string, t reflect.Type) error {
+	return &UnmarshalTypeError{value, t, lex.pos.Line, lex.pos.Column}
 }
 
-// The read function is a decoder for a small subset of well-formed
-// S-expressions.  For brevity of our example, it takes many dubious
-// shortcuts.
+// The read function is a decoder for the S-expressions produced by
+// encode. It accepts
+//   - nil, which sets v to its zero value, and t, which is true;
+//   - strings, and decimal, hexadecimal and octal integers and
+//     floating-point numbers, each optionally preceded by a minus sign;
+//   - complex numbers #C(re im);
+//   - lists, decoded as arrays, slices, structs ((name value) ...)
+//     and maps ((key value) ...);
+//   - interface values ("TypeName" value) of registered types;
+//   - datum labels: #n= before a pointer or map value names it, and
+//     a later #n# stands for the same pointer or map, so that shared
+//     and cyclic data decode with the sharing written by Marshal.
+//
+// Variables whose address implements Unmarshaler decode themselves,
+// as do those implementing encoding.TextUnmarshaler when the value
+// is a string. Struct fields are matched by the names described at
+// fields.
 //
-// The parser assumes
-// - that the S-expression input is well-formed; it does no error checking.
-// - that the S-expression input corresponds to the type of the variable.
-// - that all numbers in the input are non-negative decimal integers.
-// - that all keys in ((key value) ...) struct syntax are unquoted symbols.
-// - that the input does not contain dotted lists such as (1 2 . 3).
-// - that the input does not contain Lisp reader macros such 'x and #'x.
+// Pointers are allocated as needed. An interface receives a value of
+// the registered type named by ("TypeName" value), and otherwise the
+// natural Go representation of the value: bool, int, float64,
+// complex128, string, Symbol, or []interface{} for a list. Since a
+// list whose first element is a registered name is read as a typed
+// value, ("int" "x") decodes into an interface only as an error.
 //
-// The reflection logic assumes
-// - that v is always a variable of the appropriate type for the
-//   S-expression value.  For example, v must not be a boolean,
-//   interface, channel, or function, and if v is an array, the input
-//   must have the correct number of elements.
-// - that v in the top-level call to read has the zero value of its
-//   type and doesn't need clearing.
-// - that if v is a numeric variable, it is a signed integer.
-
-func read(lex *lexer, v reflect.Value) {
+// The reflection logic checks each value against the type of v,
+// reporting an *UnmarshalTypeError on a mismatch such as a string
+// for an int field, a number that overflows its variable, an array
+// with too many elements or a field the struct does not have.
+func read(lex *lexer, v reflect.Value) error {
+	if err := lex.peek(); err != nil {
+		return err
+	}
+	if (lex.token == labelDef || lex.token == labelRef) && v.Kind() != reflect.Interface {
+		return readLabel(lex, v)
+	}
+	if v.Kind() == reflect.Ptr {
+		if lex.token == scanner.Ident && lex.text() == "nil" {
+			v.Set(reflect.Zero(v.Type()))
+			lex.next()
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return read(lex, v.Elem())
+	}
+	if ok, err := unmarshal(lex, v); ok {
+		return err
+	}
+	if v.Kind() == reflect.Interface {
+		pos := lex.pos
+		x, err := readAny(lex)
+		if err != nil {
+			return err
+		}
+		if x == nil {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		xv := reflect.ValueOf(x)
+		if !xv.Type().AssignableTo(v.Type()) {
+			return &UnmarshalTypeError{"value of type " + xv.Type().String(), v.Type(), pos.Line, pos.Column}
+		}
+		v.Set(xv)
+		return nil
+	}
+
 	switch lex.token {
 	case scanner.Ident:
-		// The only valid identifiers are
-		// "nil" and struct field names.
-		if lex.text() == "nil" {
+		switch lex.text() {
+		case "nil":
 			v.Set(reflect.Zero(v.Type()))
 			lex.next()
-			return
+			return nil
+		case "t":
+			if v.Kind() != reflect.Bool {
+				return lex.typeError("t", v.Type())
+			}
+			v.SetBool(true)
+			lex.next()
+			return nil
+		}
+		return lex.typeError(lex.describe(), v.Type())
+	case scanner.String, scanner.RawString:
+		s, err := strconv.Unquote(lex.text())
+		if err != nil {
+			return lex.syntaxError("invalid string %s", lex.text())
+		}
+		if v.Kind() != reflect.String {
+			return lex.typeError(lex.describe(), v.Type())
 		}
-	case scanner.String:
-		s, _ := strconv.Unquote(lex.text()) // NOTE: ignoring errors
 		v.SetString(s)
 		lex.next()
-		return
-	case scanner.Int:
-		i, _ := strconv.Atoi(lex.text()) // NOTE: ignoring errors
-		v.SetInt(int64(i))
-		lex.next()
-		return
+		return nil
+	case scanner.Int, scanner.Float, '-':
+		return readNumber(lex, v)
+	case '#':
+		return readComplex(lex, v)
 	case '(':
 		lex.next()
-		readList(lex, v)
+		if err := readList(lex, v); err != nil {
+			return err
+		}
 		lex.next() // consume ')'
-		return
+		return nil
+	}
+	return lex.syntaxError("unexpected %s", lex.describe())
+}
+
+// readLabel decodes into v a value labelled #n=, or a reference #n#
+// to one. A label names the pointer or map before its contents are
+// read, so that they may refer back to it.
+func readLabel(lex *lexer, v reflect.Value) error {
+	n := lex.label()
+	if lex.token == labelRef {
+		x, ok := lex.labels[n]
+		if !ok {
+			return lex.syntaxError("undefined label #%d#", n)
+		}
+		if !x.IsValid() {
+			x = reflect.Zero(v.Type())
+		}
+		if !x.Type().AssignableTo(v.Type()) {
+			return lex.typeError("label #"+strconv.Itoa(n)+"# of type "+x.Type().String(), v.Type())
+		}
+		v.Set(x)
+		lex.next()
+		return nil
+	}
+	if _, ok := lex.labels[n]; ok {
+		return lex.syntaxError("duplicate label #%d=", n)
+	}
+	var x reflect.Value
+	switch v.Kind() {
+	case reflect.Ptr:
+		x = reflect.New(v.Type().Elem())
+	case reflect.Map:
+		x = reflect.MakeMap(v.Type())
+	default:
+		return lex.typeError("label #"+strconv.Itoa(n)+"=", v.Type())
+	}
+	v.Set(x)
+	lex.define(n, x)
+	lex.next()
+	if v.Kind() == reflect.Ptr {
+		return read(lex, x.Elem())
+	}
+	return read(lex, v)
+}
+
+func (lex *lexer) define(n int, x reflect.Value) {
+	if lex.labels == nil {
+		lex.labels = make(map[int]reflect.Value)
+	}
+	lex.labels[n] = x
+}
+
+// number consumes an optionally negated numeric literal and
+// returns its text and whether it is an integer.
+func number(lex *lexer) (text string, isInt bool, err error) {
+	if lex.token == '-' {
+		lex.next()
+		if err := lex.peek(); err != nil {
+			return "", false, err
+		}
+		if lex.token != scanner.Int && lex.token != scanner.Float {
+			return "", false, lex.syntaxError("got %s after '-', want number", lex.describe())
+		}
+		text = "-"
 	}
-	panic(fmt.Sprintf("unexpected token %q", lex.text()))
+	text += lex.text()
+	isInt = lex.token == scanner.Int
+	lex.next()
+	return text, isInt, nil
 }
 
-func readList(lex *lexer, v reflect.Value) {
+func readNumber(lex *lexer, v reflect.Value) error {
+	pos := lex.pos
+	text, isInt, err := number(lex)
+	if err != nil {
+		return err
+	}
+	mismatch := func() error {
+		return &UnmarshalTypeError{"number " + text, v.Type(), pos.Line, pos.Column}
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16,
+		reflect.Int32, reflect.Int64:
+		if !isInt {
+			return mismatch()
+		}
+		i, err := strconv.ParseInt(text, 0, v.Type().Bits())
+		if err != nil {
+			return mismatch()
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if !isInt {
+			return mismatch()
+		}
+		u, err := strconv.ParseUint(text, 0, v.Type().Bits())
+		if err != nil {
+			return mismatch()
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, v.Type().Bits())
+		if err != nil {
+			return mismatch()
+		}
+		v.SetFloat(f)
+	case reflect.Complex64, reflect.Complex128:
+		f, err := strconv.ParseFloat(text, v.Type().Bits()/2)
+		if err != nil {
+			return mismatch()
+		}
+		v.SetComplex(complex(f, 0))
+	default:
+		return mismatch()
+	}
+	return nil
+}
+
+// complexLit consumes a complex number #C(re im) and
+// returns the text of its real and imaginary parts.
+func complexLit(lex *lexer) (re, im string, err error) {
+	lex.next() // consume '#'
+	if err := lex.peek(); err != nil {
+		return "", "", err
+	}
+	if lex.token != scanner.Ident || lex.text() != "C" {
+		return "", "", lex.syntaxError("got %s after '#', want C", lex.describe())
+	}
+	lex.next()
+	if err := lex.consume('('); err != nil {
+		return "", "", err
+	}
+	for _, part := range []*string{&re, &im} {
+		if err := lex.peek(); err != nil {
+			return "", "", err
+		}
+		if lex.token != scanner.Int && lex.token != scanner.Float && lex.token != '-' {
+			return "", "", lex.syntaxError("got %s in #C, want number", lex.describe())
+		}
+		if *part, _, err = number(lex); err != nil {
+			return "", "", err
+		}
+	}
+	return re, im, lex.consume(')')
+}
+
+func readComplex(lex *lexer, v reflect.Value) error {
+	pos := lex.pos
+	re, im, err := complexLit(lex)
+	if err != nil {
+		return err
+	}
+	mismatch := &UnmarshalTypeError{"complex #C(" + re + " " + im + ")", v.Type(), pos.Line, pos.Column}
+	if v.Kind() != reflect.Complex64 && v.Kind() != reflect.Complex128 {
+		return mismatch
+	}
+	bits := v.Type().Bits() / 2
+	r, err := strconv.ParseFloat(re, bits)
+	if err != nil {
+		return mismatch
+	}
+	i, err := strconv.ParseFloat(im, bits)
+	if err != nil {
+		return mismatch
+	}
+	v.SetComplex(complex(r, i))
+	return nil
+}
+
+func readList(lex *lexer, v reflect.Value) error {
 	switch v.Kind() {
 	case reflect.Array: // (item ...)
-		for i := 0; !endList(lex); i++ {
-			read(lex, v.Index(i))
+		i := 0
+		for {
+			end, err := endList(lex)
+			if err != nil {
+				return err
+			}
+			if end {
+				break
+			}
+			if i >= v.Len() {
+				return lex.typeError("list of more than "+strconv.Itoa(v.Len())+" elements", v.Type())
+			}
+			if err := read(lex, v.Index(i)); err != nil {
+				return err
+			}
+			i++
+		}
+		for ; i < v.Len(); i++ {
+			v.Index(i).Set(reflect.Zero(v.Type().Elem()))
 		}
-		case reflect.Slice: // (item ...)
-		for !endList(lex) {
+
+	case reflect.Slice: // (item ...)
+		s := reflect.MakeSlice(v.Type(), 0, 0)
+		for {
+			end, err := endList(lex)
+			if err != nil {
+				return err
+			}
+			if end {
+				break
+			}
 			item := reflect.New(v.Type().Elem()).Elem()
-			read(lex, item)
-			v.Set(reflect.Append(v, item))
+			if err := read(lex, item); err != nil {
+				return err
+			}
+			s = reflect.Append(s, item)
 		}
+		v.Set(s)
 
 	case reflect.Struct: // ((name value) ...)
-		for !endList(lex) {
-			lex.consume('(')
+		for {
+			end, err := endList(lex)
+			if err != nil {
+				return err
+			}
+			if end {
+				break
+			}
+			if err := lex.consume('('); err != nil {
+				return err
+			}
+			if err := lex.peek(); err != nil {
+				return err
+			}
 			if lex.token != scanner.Ident {
-				panic(fmt.Sprintf("got token %q, want field name", lex.text()))
+				return lex.syntaxError("got %s, want field name", lex.describe())
 			}
 			name := lex.text()
+			f := fieldByName(v, name)
+			if !f.IsValid() {
+				return lex.typeError("field "+name, v.Type())
+			}
 			lex.next()
-			read(lex, v.FieldByName(name))
-			lex.consume(')')
+			if err := read(lex, f); err != nil {
+				return err
+			}
+			if err := lex.consume(')'); err != nil {
+				return err
+			}
 		}
 
 	case reflect.Map: // ((key value) ...)
-		v.Set(reflect.MakeMap(v.Type()))
-		for !endList(lex) {
-			lex.consume('(')
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for {
+			end, err := endList(lex)
+			if err != nil {
+				return err
+			}
+			if end {
+				break
+			}
+			if err := lex.consume('('); err != nil {
+				return err
+			}
 			key := reflect.New(v.Type().Key()).Elem()
-			read(lex, key)
+			if err := read(lex, key); err != nil {
+				return err
+			}
 			value := reflect.New(v.Type().Elem()).Elem()
-			read(lex, value)
+			if err := read(lex, value); err != nil {
+				return err
+			}
 			v.SetMapIndex(key, value)
-			lex.consume(')')
+			if err := lex.consume(')'); err != nil {
+				return err
+			}
 		}
 
 	default:
-		panic(fmt.Sprintf("cannot decode list into %v", v.Type()))
+		return lex.typeError("list", v.Type())
 	}
+	return nil
 }
 
-func endList(lex *lexer) bool {
+// fieldByName returns the field of struct v encoded as name,
+// or the zero Value if there is none.
+func fieldByName(v reflect.Value, name string) reflect.Value {
+	for _, f := range fields(v.Type()) {
+		if f.name == name {
+			return v.Field(f.index)
+		}
+	}
+	return reflect.Value{}
+}
+
+// unmarshal lets a variable whose address implements Unmarshaler
+// decode the text of the next value itself. Failing that, a string
+// is decoded by the encoding.TextUnmarshaler method if there is one.
+// It reports whether v was handled.
+func unmarshal(lex *lexer, v reflect.Value) (bool, error) {
+	if !v.CanAddr() {
+		return false, nil
+	}
+	p := v.Addr()
+	if p.Type().Implements(unmarshalerType) {
+		data, err := rawValue(lex)
+		if err != nil {
+			return true, err
+		}
+		return true, p.Interface().(Unmarshaler).UnmarshalSexpr(data)
+	}
+	if p.Type().Implements(textUnmarshalerType) &&
+		(lex.token == scanner.String || lex.token == scanner.RawString) {
+		s, err := strconv.Unquote(lex.text())
+		if err != nil {
+			return true, lex.syntaxError("invalid string %s", lex.text())
+		}
+		if err := p.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			return true, lex.typeError(fmt.Sprintf("string %s (%v)", lex.text(), err), v.Type())
+		}
+		lex.next()
+		return true, nil
+	}
+	return false, nil
+}
+
+// rawValue consumes the next value and returns its text,
+// with insignificant white space removed.
+func rawValue(lex *lexer) ([]byte, error) {
+	var buf bytes.Buffer
+	space := func() {
+		if n := buf.Len(); n > 0 && buf.Bytes()[n-1] != '(' && buf.Bytes()[n-1] != '=' {
+			buf.WriteByte(' ')
+		}
+	}
+	depth := 0
+	for {
+		if err := lex.peek(); err != nil {
+			return nil, err
+		}
+		switch lex.token {
+		case scanner.EOF:
+			return nil, lex.syntaxError("unexpected end of input")
+		case '(':
+			space()
+			buf.WriteByte('(')
+			depth++
+			lex.next()
+		case ')':
+			if depth == 0 {
+				return nil, lex.syntaxError("unexpected ')'")
+			}
+			buf.WriteByte(')')
+			depth--
+			lex.next()
+		case labelDef: // labels the value that follows
+			space()
+			buf.WriteString(lex.text())
+			lex.next()
+			continue
+		case scanner.Ident, scanner.String, scanner.RawString, labelRef:
+			space()
+			buf.WriteString(lex.text())
+			lex.next()
+		case scanner.Int, scanner.Float, '-':
+			text, _, err := number(lex)
+			if err != nil {
+				return nil, err
+			}
+			space()
+			buf.WriteString(text)
+		case '#':
+			re, im, err := complexLit(lex)
+			if err != nil {
+				return nil, err
+			}
+			space()
+			fmt.Fprintf(&buf, "#C(%s %s)", re, im)
+		default:
+			return nil, lex.syntaxError("unexpected %s", lex.describe())
+		}
+		if depth == 0 {
+			return buf.Bytes(), nil
+		}
+	}
+}
+
+// compact checks that data holds exactly one S-expression
+// and returns it with insignificant white space removed.
+func compact(data []byte) ([]byte, error) {
+	lex := newLexer(bytes.NewReader(data))
+	raw, err := rawValue(lex)
+	if err != nil {
+		return nil, err
+	}
+	if err := lex.peek(); err != nil {
+		return nil, err
+	}
+	if lex.token != scanner.EOF {
+		return nil, lex.syntaxError("unexpected %s after top-level value", lex.describe())
+	}
+	return raw, nil
+}
+
+// readAny decodes the next value without a target type,
+// choosing the natural Go representation described at read.
+// A label may name such a value, but since a list is built only
+// once its elements are read, none of them may refer back to it.
+func readAny(lex *lexer) (interface{}, error) {
+	if err := lex.peek(); err != nil {
+		return nil, err
+	}
+	switch lex.token {
+	case scanner.Ident:
+		s := lex.text()
+		var x interface{} = Symbol(s)
+		switch s {
+		case "nil":
+			x = nil
+		case "t":
+			x = true
+		}
+		lex.next()
+		return x, nil
+	case scanner.String, scanner.RawString:
+		s, err := strconv.Unquote(lex.text())
+		if err != nil {
+			return nil, lex.syntaxError("invalid string %s", lex.text())
+		}
+		lex.next()
+		return s, nil
+	case scanner.Int, scanner.Float, '-':
+		pos := lex.pos
+		text, isInt, err := number(lex)
+		if err != nil {
+			return nil, err
+		}
+		if isInt {
+			if i, err := strconv.ParseInt(text, 0, 0); err == nil {
+				return int(i), nil
+			}
+			if u, err := strconv.ParseUint(text, 0, 64); err == nil {
+				return u, nil
+			}
+		} else if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return f, nil
+		}
+		return nil, &UnmarshalTypeError{"number " + text, reflect.TypeOf(0), pos.Line, pos.Column}
+	case '#':
+		pos := lex.pos
+		re, im, err := complexLit(lex)
+		if err != nil {
+			return nil, err
+		}
+		r, err1 := strconv.ParseFloat(re, 64)
+		i, err2 := strconv.ParseFloat(im, 64)
+		if err1 != nil || err2 != nil {
+			return nil, &UnmarshalTypeError{"complex #C(" + re + " " + im + ")", reflect.TypeOf(0i), pos.Line, pos.Column}
+		}
+		return complex(r, i), nil
+	case labelDef:
+		n := lex.label()
+		if _, ok := lex.labels[n]; ok {
+			return nil, lex.syntaxError("duplicate label #%d=", n)
+		}
+		lex.next()
+		x, err := readAny(lex)
+		if err != nil {
+			return nil, err
+		}
+		lex.define(n, reflect.ValueOf(x))
+		return x, nil
+	case labelRef:
+		n := lex.label()
+		x, ok := lex.labels[n]
+		if !ok {
+			return nil, lex.syntaxError("undefined label #%d#", n)
+		}
+		lex.next()
+		if !x.IsValid() {
+			return nil, nil
+		}
+		return x.Interface(), nil
+	case '(':
+		lex.next()
+		if err := lex.peek(); err != nil {
+			return nil, err
+		}
+		// ("TypeName" value) is an interface value of a registered type.
+		if lex.token == scanner.String {
+			if name, err := strconv.Unquote(lex.text()); err == nil {
+				if t, ok := typeByName(name); ok {
+					lex.next()
+					x := reflect.New(t).Elem()
+					if err := read(lex, x); err != nil {
+						return nil, err
+					}
+					return x.Interface(), lex.consume(')')
+				}
+			}
+		}
+		list := []interface{}{}
+		for {
+			end, err := endList(lex)
+			if err != nil {
+				return nil, err
+			}
+			if end {
+				break
+			}
+			x, err := readAny(lex)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, x)
+		}
+		lex.next() // consume ')'
+		return list, nil
+	}
+	return nil, lex.syntaxError("unexpected %s", lex.describe())
+}
+
+func endList(lex *lexer) (bool, error) {
+	if err := lex.peek(); err != nil {
+		return false, err
+	}
 	switch lex.token {
 	case scanner.EOF:
-		panic("end of file")
+		return false, lex.syntaxError("unexpected end of input in list")
 	case ')':
-		return true
+		return true, nil
 	}
-	return false
+	return false, nil
 }
-
-// Note that a production quality implmentation should
-// never panic for any input and should report an
-// informative error for every mishap, perhaps with a
-// line number of offset. This implementation should convey
-// an idea of what is happening under of the hood of packages like
-// encoding/json and how reflection is used to populate data structures.
@@ -0,0 +1,487 @@
+package sexpr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Movie struct {
+	Title, Subtitle string
+	Year            int
+	Color           bool
+	Actor           map[string]string
+	Oscars          []string
+	Sequel          *string
+}
+
+var strangelove = Movie{
+	Title:    "Dr. Strangelove",
+	Subtitle: "How I Learned to Stop Worrying and Love the Bomb",
+	Year:     1964,
+	Color:    false,
+	Actor: map[string]string{
+		"Dr. Strangelove":            "Peter Sellers",
+		"Grp. Capt. Lionel Mandrake": "Peter Sellers",
+		"Pres. Merkin Muffley":       "Peter Sellers",
+		"Gen. Buck Turgidson":        "George C. Scott",
+		"Brig. Gen. Jack D. Ripper":  "Sterling Hayden",
+		`Maj. T.J. "King" Kong`:      "Slim Pickens",
+	},
+	Oscars: []string{
+		"Best Actor (Nomin.)",
+		"Best Adapted Screenplay (Nomin.)",
+		"Best Director (Nomin.)",
+		"Best Picture (Nomin.)",
+	},
+}
+
+func init() { Register(Movie{}) }
+
+func TestRoundTrip(t *testing.T) {
+	data, err := Marshal(strangelove)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var movie Movie
+	if err := Unmarshal(data, &movie); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(movie, strangelove) {
+		t.Errorf("round trip changed value:\n got %+v\nwant %+v", movie, strangelove)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	type point struct{ X, Y float64 }
+	one := 1
+	tests := []struct {
+		input string
+		ptr   interface{} // pointer to a zero value of the target type
+		want  interface{}
+	}{
+		{`-42`, new(int), -42},
+		{`0x7f`, new(int8), int8(127)},
+		{`18446744073709551615`, new(uint64), uint64(18446744073709551615)},
+		{`-2.5`, new(float64), -2.5},
+		{`3`, new(float32), float32(3)},
+		{`t`, new(bool), true},
+		{`nil`, new(bool), false},
+		{`"a\tb"`, new(string), "a\tb"},
+		{"`raw`", new(string), "raw"},
+		{`1`, new(*int), &one},
+		{`nil`, new(*int), (*int)(nil)},
+		{`(1 2)`, new([3]int), [3]int{1, 2, 0}},
+		{`()`, new([]int), []int{}},
+		{`((X -1) (Y 0.5))`, new(point), point{-1, 0.5}},
+		{`((1 t) (2 nil))`, new(map[int]bool), map[int]bool{1: true, 2: false}},
+		{`(1 -2.5 "s" t nil sym (x) #C(1 -2))`, new(interface{}),
+			[]interface{}{1, -2.5, "s", true, nil, Symbol("sym"), []interface{}{Symbol("x")}, 1 - 2i}},
+		{`#C(0.5 -1e3)`, new(complex64), complex64(0.5 - 1e3i)},
+		{`("int8" -3)`, new(interface{}), int8(-3)},
+		{`(("uint" 1) ("sexpr.Movie" ((Year 1964))))`, new(interface{}),
+			[]interface{}{uint(1), Movie{Year: 1964}}},
+	}
+	for _, test := range tests {
+		if err := Unmarshal([]byte(test.input), test.ptr); err != nil {
+			t.Errorf("Unmarshal(%s, %T): %v", test.input, test.ptr, err)
+			continue
+		}
+		got := reflect.ValueOf(test.ptr).Elem().Interface()
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Unmarshal(%s, %T) = %#v, want %#v", test.input, test.ptr, got, test.want)
+		}
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	type point struct{ X, Y int }
+	tests := []struct {
+		input        string
+		ptr          interface{}
+		syntax       bool // want *SyntaxError rather than *UnmarshalTypeError
+		line, column int
+	}{
+		{`(1 2`, new([]int), true, 1, 5},
+		{"((X 1)\n (Y 2) (Z 3))", new(point), false, 2, 9},
+		{`((X "one"))`, new(point), false, 1, 5},
+		{`300`, new(int8), false, 1, 1},
+		{`-1`, new(uint), false, 1, 1},
+		{`1.5`, new(int), false, 1, 1},
+		{`(1 2 3)`, new([2]int), false, 1, 6},
+		{`1 2`, new(int), true, 1, 3},
+		{`- x`, new(int), true, 1, 3},
+		{`"unterminated`, new(string), true, 1, 1},
+		{`)`, new(int), true, 1, 1},
+		{`t`, new(int), false, 1, 1},
+		{`(1)`, new(error), false, 1, 1},
+		{`("int" 1)`, new(fmt.Stringer), false, 1, 1},
+		{`("nosuchtype" 1)`, new(int), false, 1, 1},
+		{`#C(1 x)`, new(complex128), true, 1, 6},
+		{`#D(1 2)`, new(complex128), true, 1, 2},
+		{`#C(1 2)`, new(float64), false, 1, 1},
+		{`(#1# 2)`, new([]*int), true, 1, 2},
+		{`(#1=1 #1=2)`, new([]*int), true, 1, 7},
+		{`#1 2`, new(*int), true, 1, 4},
+		{`#1=1`, new(int), false, 1, 1},
+		{`((P #1=1) (Q #1#))`, new(struct {
+			P *int
+			Q *int8
+		}), false, 1, 14},
+	}
+	for _, test := range tests {
+		err := Unmarshal([]byte(test.input), test.ptr)
+		var line, column int
+		var syntaxErr *SyntaxError
+		var typeErr *UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr) && test.syntax:
+			line, column = syntaxErr.Line, syntaxErr.Column
+		case errors.As(err, &typeErr) && !test.syntax:
+			line, column = typeErr.Line, typeErr.Column
+		default:
+			t.Errorf("Unmarshal(%q, %T) = %v (%T), want syntax error %t",
+				test.input, test.ptr, err, err, test.syntax)
+			continue
+		}
+		if line != test.line || column != test.column {
+			t.Errorf("Unmarshal(%q, %T): error %q at %d:%d, want %d:%d",
+				test.input, test.ptr, err, line, column, test.line, test.column)
+		}
+	}
+
+	var notPtr Movie
+	var invalid *InvalidUnmarshalError
+	if err := Unmarshal([]byte(`()`), notPtr); !errors.As(err, &invalid) {
+		t.Errorf("Unmarshal into non-pointer: got %v, want InvalidUnmarshalError", err)
+	}
+}
+
+// FuzzUnmarshal checks that no input makes Unmarshal panic,
+// whatever type it is decoding into.
+func FuzzUnmarshal(f *testing.F) {
+	data, err := Marshal(strangelove)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(string(data))
+	for _, seed := range []string{
+		`nil`, `t`, `-1`, `0x10`, `1e9`, `"s"`, "`r`", `(1 2 3)`,
+		`((a 1) (b 2))`, `((Title "x") (Year -1))`, `(`, `)`, `'c'`, `- -`,
+		`#C(1 -2.5)`, `("int" 1)`, `("sexpr.Movie" ((Color t)))`, `#C(`,
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		for _, ptr := range []interface{}{
+			new(Movie), new(interface{}), new([]int), new([2]int8),
+			new(map[string]int), new(*uint16), new(float32), new(error),
+			new(complex64), new([]interface{}),
+		} {
+			Unmarshal([]byte(s), ptr) // must not panic
+		}
+	})
+}
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{true, `t`},
+		{false, `nil`},
+		{1.5, `1.5`},
+		{float32(3), `3.0`},
+		{1e21, `1e+21`},
+		{-2 + 0.5i, `#C(-2.0 0.5)`},
+		{uintptr(1), `1`},
+		{[]interface{}{1, "a", nil, []int{2}}, `(("int" 1) ("string" "a") nil ("[]int" (2)))`},
+		{struct{ X interface{} }{Movie{Year: 1}}, `((X ("sexpr.Movie" ((Title "") (Subtitle "") (Year 1) (Color nil) (Actor ()) (Oscars ()) (Sequel nil)))))`},
+	}
+	for _, test := range tests {
+		data, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Marshal(%#v): %v", test.v, err)
+			continue
+		}
+		if string(data) != test.want {
+			t.Errorf("Marshal(%#v) = %s, want %s", test.v, data, test.want)
+		}
+	}
+	if _, err := Marshal(math.NaN()); err == nil {
+		t.Errorf("Marshal(NaN) succeeded, want error")
+	}
+
+	// Values inside interfaces come back with their dynamic types.
+	in := []interface{}{int8(1), uintptr(2), 2.5, 3i, strangelove, []interface{}{"y"}}
+	data, err := Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out interface{}
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("Unmarshal(%s) = %#v, want %#v", data, out, in)
+	}
+}
+
+type Cycle struct {
+	Value int
+	Tail  *Cycle
+}
+
+func init() { Register(&Cycle{}) }
+
+func TestSharing(t *testing.T) {
+	var c Cycle
+	c = Cycle{42, &c}
+	data, err := Marshal(&c)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if want := `#1=((Value 42) (Tail #1#))`; string(data) != want {
+		t.Errorf("Marshal(cycle) = %s, want %s", data, want)
+	}
+	var cycle *Cycle
+	if err := Unmarshal(data, &cycle); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if cycle.Value != 42 || cycle.Tail != cycle {
+		t.Errorf("Unmarshal(%s) did not rebuild the cycle", data)
+	}
+
+	// Shared pointers and maps, directly and within interfaces.
+	type shared struct {
+		P, Q *int
+		M, N map[string]int
+		I    []interface{}
+	}
+	x := 1
+	m := map[string]int{"b": 2, "c": 3, "a": 1}
+	in := shared{P: &x, Q: &x, M: m, N: m, I: []interface{}{&c, &c}}
+	data, err = Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	want := `((P #1=1) (Q #1#) (M #2=(("a" 1) ("b" 2) ("c" 3))) (N #2#) ` +
+		`(I (("*sexpr.Cycle" #3=((Value 42) (Tail #3#))) ("*sexpr.Cycle" #3#))))`
+	if string(data) != want {
+		t.Errorf("Marshal(shared):\n got %s\nwant %s", data, want)
+	}
+	var out shared
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if out.P != out.Q || *out.P != 1 {
+		t.Errorf("Unmarshal: pointers not shared")
+	}
+	out.M["d"] = 4
+	if out.N["d"] != 4 {
+		t.Errorf("Unmarshal: maps not shared")
+	}
+	c1, ok1 := out.I[0].(*Cycle)
+	c2, ok2 := out.I[1].(*Cycle)
+	if !ok1 || !ok2 || c1 != c2 || c1.Tail != c1 {
+		t.Errorf("Unmarshal: interface values %v not shared", out.I)
+	}
+
+	// A slice that contains itself has nowhere to put a label.
+	loop := []interface{}{nil}
+	loop[0] = loop
+	if _, err := Marshal(loop); err == nil {
+		t.Errorf("Marshal(cyclic slice) succeeded, want error")
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	const input = `((X 1)) ((X -2))
+	(a "b" 3 4.5)`
+	dec := NewDecoder(strings.NewReader(input))
+	for _, want := range []int{1, -2} {
+		var p struct{ X int }
+		if err := dec.Decode(&p); err != nil {
+			t.Fatal(err)
+		}
+		if p.X != want {
+			t.Errorf("Decode: X = %d, want %d", p.X, want)
+		}
+	}
+	var got []Token
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, tok)
+	}
+	want := []Token{StartList{}, Symbol("a"), String("b"), Int("3"), Float("4.5"), EndList{}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Token: got %v, want %v", got, want)
+	}
+
+	// Decode and Token may be interleaved.
+	dec = NewDecoder(strings.NewReader(`(1 2 3)`))
+	if _, err := dec.Token(); err != nil {
+		t.Fatal(err)
+	}
+	var sum int
+	for dec.More() {
+		var i int
+		if err := dec.Decode(&i); err != nil {
+			t.Fatal(err)
+		}
+		sum += i
+	}
+	if sum != 6 {
+		t.Errorf("sum of decoded list elements = %d, want 6", sum)
+	}
+	if tok, err := dec.Token(); err != nil || tok != (EndList{}) {
+		t.Errorf("Token() = %v, %v; want EndList", tok, err)
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	var buf strings.Builder
+	enc := NewEncoder(&buf)
+	for _, v := range []interface{}{1, "two", []int{3}} {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := buf.String(), "1\n\"two\"\n(3)\n"; got != want {
+		t.Errorf("Encode wrote %q, want %q", got, want)
+	}
+}
+
+// celsius controls its own representation, (C degrees).
+type celsius int
+
+func (c celsius) MarshalSexpr() ([]byte, error) {
+	return []byte(fmt.Sprintf("(C %d)", int(c))), nil
+}
+
+func (c *celsius) UnmarshalSexpr(data []byte) error {
+	var sym Symbol
+	var degrees int
+	if _, err := fmt.Sscanf(string(data), "(%s %d)", &sym, &degrees); err != nil {
+		return err
+	}
+	*c = celsius(degrees)
+	return nil
+}
+
+func TestTagsAndMarshalers(t *testing.T) {
+	type reading struct {
+		Temp    celsius   `sexp:"temp"`
+		When    time.Time `sexp:"at"`
+		Note    string    `sexp:"note,omitempty"`
+		Skipped int       `sexp:"-"`
+		private int
+	}
+	when := time.Date(1964, 1, 29, 12, 0, 0, 0, time.UTC)
+	in := reading{Temp: -5, When: when, Skipped: 1, private: 2}
+	data, err := Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `((temp (C -5)) (at "1964-01-29T12:00:00Z"))`
+	if string(data) != want {
+		t.Errorf("Marshal = %s, want %s", data, want)
+	}
+
+	var out reading
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Temp != in.Temp || !out.When.Equal(when) || out.Skipped != 0 || out.private != 0 {
+		t.Errorf("Unmarshal(%s) = %+v", data, out)
+	}
+	if err := Unmarshal([]byte(`((private 1))`), &out); err == nil {
+		t.Errorf("Unmarshal set an unexported field")
+	}
+}
+
+func TestMarshalIndent(t *testing.T) {
+	movie := strangelove
+	movie.Actor = map[string]string{"Dr. Strangelove": "Peter Sellers"}
+	data, err := MarshalIndent(movie, 1, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `((Title "Dr. Strangelove")
+ (Subtitle
+  "How I Learned to Stop Worrying and Love the Bomb")
+ (Year 1964)
+ (Color nil)
+ (Actor (("Dr. Strangelove" "Peter Sellers")))
+ (Oscars ("Best Actor (Nomin.)"
+          "Best Adapted Screenplay (Nomin.)"
+          "Best Director (Nomin.)" "Best Picture (Nomin.)"))
+ (Sequel nil))
+`
+	if string(data) != want {
+		t.Errorf("MarshalIndent:\n%s\nwant:\n%s", data, want)
+	}
+
+	// Reformatting preserves the value.
+	var got Movie
+	if err := Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, movie) {
+		t.Errorf("Unmarshal(MarshalIndent(x)) = %+v, want %+v", got, movie)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	data, err := Marshal(strangelove)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, `((Title "Fail-Safe") (Year 1964))`...)
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{`(Actor "Dr. Strangelove")`, []string{`"Peter Sellers"`}},
+		{`Actor/"Gen. Buck Turgidson"`, []string{`"George C. Scott"`}},
+		{`Oscars/*`, []string{`"Best Actor (Nomin.)"`, `"Best Adapted Screenplay (Nomin.)"`,
+			`"Best Director (Nomin.)"`, `"Best Picture (Nomin.)"`}},
+		{`Title`, []string{`"Dr. Strangelove"`, `"Fail-Safe"`}},
+		{`(** Year)`, []string{`1964`, `1964`}},
+		{`Sequel`, []string{`nil`}},
+		{`Director`, nil},
+	}
+	for _, test := range tests {
+		path, err := ParsePath(test.path)
+		if err != nil {
+			t.Errorf("ParsePath(%q): %v", test.path, err)
+			continue
+		}
+		var got []string
+		err = path.Select(strings.NewReader(string(data)), func(match []byte) error {
+			got = append(got, string(match))
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: Select failed: %v", path, err)
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Select = %q, want %q", path, got, test.want)
+		}
+	}
+
+	for _, bad := range []string{``, `()`, `Actor/`, `(Actor`, `Actor Oscars`, `a/(b)`} {
+		if _, err := ParsePath(bad); err == nil {
+			t.Errorf("ParsePath(%q) succeeded, want error", bad)
+		}
+	}
+}
@@ -2,12 +2,133 @@ package sexpr
 
 import (
 	"bytes"
+	"encoding"
 	"fmt"
+	"math"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 // encode writes to buf an S-expression representation of v.
 func encode(buf *bytes.Buffer, v reflect.Value) error {
+	e := &encodeState{buf: buf, refs: make(map[ref]int), labels: make(map[ref]int)}
+	if err := e.scan(v, nil); err != nil {
+		return err
+	}
+	return e.encode(v)
+}
+
+// An encodeState holds the state of a single call to encode.
+type encodeState struct {
+	buf    *bytes.Buffer
+	refs   map[ref]int // number of references to each pointer and map
+	labels map[ref]int // label of each shared pointer and map written so far
+}
+
+// A ref identifies a pointer or map. The type is needed to tell
+// apart a pointer to a struct and a pointer to its first field.
+type ref struct {
+	ptr uintptr
+	t   reflect.Type
+}
+
+// scan counts the references to each pointer and map reachable from
+// v, following each only once, so that encode can label those that
+// are shared. A cycle that passes through no pointer or map, such as
+// a slice that contains itself, cannot be labelled and is an error;
+// path holds the slices visited since the last pointer or map.
+func (e *encodeState) scan(v reflect.Value, path map[ref]bool) error {
+	if _, ok := implements(v, marshalerType); ok {
+		return nil
+	}
+	if _, ok := implements(v, textMarshalerType); ok {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		r := ref{v.Pointer(), v.Type()}
+		if e.refs[r]++; e.refs[r] > 1 {
+			return nil
+		}
+		if v.Kind() == reflect.Ptr {
+			return e.scan(v.Elem(), nil)
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := e.scan(iter.Key(), nil); err != nil {
+				return err
+			}
+			if err := e.scan(iter.Value(), nil); err != nil {
+				return err
+			}
+		}
+	case reflect.Interface:
+		return e.scan(v.Elem(), path)
+	case reflect.Slice:
+		if v.Len() == 0 {
+			return nil
+		}
+		r := ref{v.Pointer(), v.Type()}
+		if path[r] {
+			return fmt.Errorf("unsupported value: cyclic %s", v.Type())
+		}
+		if path == nil {
+			path = make(map[ref]bool)
+		}
+		path[r] = true
+		defer delete(path, r)
+		fallthrough
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := e.scan(v.Index(i), path); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		for _, f := range fields(v.Type()) {
+			fv := v.Field(f.index)
+			if f.omitEmpty && isEmptyValue(fv) {
+				continue
+			}
+			if err := e.scan(fv, path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// label writes the datum label of v, a pointer or map, if v is
+// shared: #n= before its first occurrence, or #n# in place of each
+// later one, in which case it reports that v has been written.
+func (e *encodeState) label(v reflect.Value) bool {
+	if v.IsNil() {
+		return false
+	}
+	r := ref{v.Pointer(), v.Type()}
+	if e.refs[r] < 2 {
+		return false
+	}
+	if n, ok := e.labels[r]; ok {
+		fmt.Fprintf(e.buf, "#%d#", n)
+		return true
+	}
+	n := len(e.labels) + 1
+	e.labels[r] = n
+	fmt.Fprintf(e.buf, "#%d=", n)
+	return false
+}
+
+func (e *encodeState) encode(v reflect.Value) error {
+	buf := e.buf
+	if ok, err := marshal(buf, v); ok {
+		return err
+	}
 	switch v.Kind() {
 	case reflect.Invalid:
 		buf.WriteString("nil")
@@ -15,62 +136,211 @@ func encode(buf *bytes.Buffer, v reflect.Value) error {
 		reflect.Int32, reflect.Int64:
 		fmt.Fprintf(buf, "%d", v.Int())
 	case reflect.Uint, reflect.Uint8, reflect.Uint16,
-		reflect.Uint32, reflect.Uint64:
+		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		fmt.Fprintf(buf, "%d", v.Uint())
+	case reflect.Bool: // t or nil
+		if v.Bool() {
+			buf.WriteByte('t')
+		} else {
+			buf.WriteString("nil")
+		}
+	case reflect.Float32, reflect.Float64:
+		s, err := formatFloat(v.Float(), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		buf.WriteString(s)
+	case reflect.Complex64, reflect.Complex128: // #C(re im)
+		bits := v.Type().Bits() / 2
+		re, err := formatFloat(real(v.Complex()), bits)
+		if err != nil {
+			return err
+		}
+		im, err := formatFloat(imag(v.Complex()), bits)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(buf, "#C(%s %s)", re, im)
 	case reflect.String:
 		fmt.Fprintf(buf, "%q", v.String())
+	case reflect.Interface: // ("TypeName" value)
+		if v.IsNil() {
+			buf.WriteString("nil")
+			return nil
+		}
+		fmt.Fprintf(buf, "(%q ", typeName(v.Elem().Type()))
+		if err := e.encode(v.Elem()); err != nil {
+			return err
+		}
+		buf.WriteByte(')')
 	case reflect.Ptr:
-		return encode(buf, v.Elem())
+		if e.label(v) {
+			return nil
+		}
+		return e.encode(v.Elem())
 	case reflect.Array, reflect.Slice: // (value ...)
 		buf.WriteByte('(')
 		for i := 0; i < v.Len(); i++ {
 			if i > 0 {
 				buf.WriteByte(' ')
 			}
-			if err := encode(buf, v.Index(i)); err != nil {
+			if err := e.encode(v.Index(i)); err != nil {
 				return err
 			}
 		}
 		buf.WriteByte(')')
 	case reflect.Struct: // ((name value) ...)
 		buf.WriteByte('(')
-		for i := 0; i < v.NumField(); i++ {
-			if i > 0 {
+		sep := false
+		for _, f := range fields(v.Type()) {
+			fv := v.Field(f.index)
+			if f.omitEmpty && isEmptyValue(fv) {
+				continue
+			}
+			if sep {
 				buf.WriteByte(' ')
 			}
-			fmt.Fprintf(buf, "(%s ", v.Type().Field(i).Name)
-			if err := encode(buf, v.Field(i)); err != nil {
+			sep = true
+			fmt.Fprintf(buf, "(%s ", f.name)
+			if err := e.encode(fv); err != nil {
 				return err
 			}
 			buf.WriteByte(')')
 		}
 		buf.WriteByte(')')
-	case reflect.Map: // ((key value) ...)
+	case reflect.Map: // ((key value) ...), sorted by key
+		if e.label(v) {
+			return nil
+		}
+		keys, err := sortedKeys(v)
+		if err != nil {
+			return err
+		}
 		buf.WriteByte('(')
-		for i, key := range v.MapKeys() {
+		for i, key := range keys {
 			if i > 0 {
 				buf.WriteByte(' ')
 			}
 			buf.WriteByte('(')
-			if err := encode(buf, key); err != nil {
+			if err := e.encode(key); err != nil {
 				return err
 			}
 			buf.WriteByte(' ')
-			if err := encode(buf, v.MapIndex(key)); err != nil {
+			if err := e.encode(v.MapIndex(key)); err != nil {
 				return err
 			}
 			buf.WriteByte(')')
 		}
 		buf.WriteByte(')')
-	default: // float, complex, bool, chan, func, interface
+	default: // chan, func, unsafe.Pointer
 		return fmt.Errorf("unsupported type: %s", v.Type())
 	}
 	return nil
 }
 
+// sortedKeys returns the keys of map v in the order of their
+// encodings, so that the output does not vary from run to run.
+func sortedKeys(v reflect.Value) ([]reflect.Value, error) {
+	keys := v.MapKeys()
+	text := make([]string, len(keys))
+	for i, key := range keys {
+		var buf bytes.Buffer
+		if err := encode(&buf, key); err != nil {
+			return nil, err
+		}
+		text[i] = buf.String()
+	}
+	sort.Sort(byText{keys, text})
+	return keys, nil
+}
+
+type byText struct {
+	keys []reflect.Value
+	text []string
+}
+
+func (x byText) Len() int           { return len(x.keys) }
+func (x byText) Less(i, j int) bool { return x.text[i] < x.text[j] }
+func (x byText) Swap(i, j int) {
+	x.keys[i], x.keys[j] = x.keys[j], x.keys[i]
+	x.text[i], x.text[j] = x.text[j], x.text[i]
+}
+
+// formatFloat formats f in the shortest form that reads back as the
+// same value, always with a decimal point or exponent so that it
+// is not mistaken for an integer. Infinities and NaN, which have no
+// S-expression syntax, are reported as errors.
+func formatFloat(f float64, bits int) (string, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", fmt.Errorf("unsupported value: %v", f)
+	}
+	s := strconv.FormatFloat(f, 'g', -1, bits)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s, nil
+}
+
+// marshal lets v choose its own representation if its type, or a
+// pointer to it when v is addressable, implements Marshaler or,
+// failing that, encoding.TextMarshaler, whose text is written as a
+// string. It reports whether v was handled.
+func marshal(buf *bytes.Buffer, v reflect.Value) (bool, error) {
+	if m, ok := implements(v, marshalerType); ok {
+		data, err := m.(Marshaler).MarshalSexpr()
+		if err == nil {
+			data, err = compact(data)
+		}
+		if err != nil {
+			return true, fmt.Errorf("sexpr: marshaling %s: %v", v.Type(), err)
+		}
+		buf.Write(data)
+		return true, nil
+	}
+	if m, ok := implements(v, textMarshalerType); ok {
+		text, err := m.(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return true, fmt.Errorf("sexpr: marshaling %s: %v", v.Type(), err)
+		}
+		buf.WriteString(strconv.Quote(string(text)))
+		return true, nil
+	}
+	return false, nil
+}
+
+// implements returns v, or its address if v is addressable, as an
+// interface value if it implements the interface type t.
+// Nil pointers and interfaces are left to the caller, to be encoded
+// as nil rather than passed to a method that may not expect them.
+func implements(v reflect.Value, t reflect.Type) (interface{}, bool) {
+	switch v.Kind() {
+	case reflect.Invalid, reflect.Interface:
+		return nil, false
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, false
+		}
+	}
+	if !v.CanInterface() {
+		return nil, false
+	}
+	if v.Type().Implements(t) {
+		return v.Interface(), true
+	}
+	if v.CanAddr() && reflect.PtrTo(v.Type()).Implements(t) {
+		return v.Addr().Interface(), true
+	}
+	return nil, false
+}
+
 // Marshal wraps the encoder in an API similar to
 // those of the other encoding/... packages.
 // It encodes a Go value in S-expression form.
+//
+// A pointer or map reached more than once, as in shared or cyclic
+// data, is written in full only the first time, preceded by a datum
+// label #n=, and as a reference #n# thereafter. Map entries are
+// sorted by the encoding of their keys.
 func Marshal(v interface{}) ([]byte, error) {
 	var buf bytes.Buffer
 	if err := encode(&buf, reflect.ValueOf(v)); err != nil {
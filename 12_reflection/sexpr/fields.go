@@ -0,0 +1,78 @@
+package sexpr
+
+import (
+	"encoding"
+	"reflect"
+	"strings"
+)
+
+// Marshaler is the interface implemented by types that can
+// marshal themselves into a valid S-expression.
+type Marshaler interface {
+	MarshalSexpr() ([]byte, error)
+}
+
+// Unmarshaler is the interface implemented by types that can
+// unmarshal an S-expression of themselves. UnmarshalSexpr receives
+// the text of a single, complete value.
+type Unmarshaler interface {
+	UnmarshalSexpr([]byte) error
+}
+
+var (
+	marshalerType       = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	unmarshalerType     = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// A field describes how a struct field is encoded.
+type field struct {
+	name      string // symbol naming the field in ((name value) ...)
+	index     int
+	omitEmpty bool
+}
+
+// fields returns the encoded fields of struct type t.
+// Unexported fields are skipped, as are fields tagged `sexp:"-"`.
+// Otherwise a field is named by its tag, if any, or its Go name:
+//
+//	Year  int      `sexp:"year"`
+//	Notes []string `sexp:",omitempty"`
+//	cache []byte   // unexported: never encoded
+func fields(t reflect.Type) []field {
+	var fs []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" { // unexported
+			continue
+		}
+		tag := sf.Tag.Get("sexp")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = sf.Name
+		}
+		fs = append(fs, field{name, i, opts == "omitempty"})
+	}
+	return fs
+}
+
+// isEmptyValue reports whether v is the zero value of a number, bool
+// or string, or a nil or empty pointer, interface or collection,
+// and so should be omitted from a field tagged omitempty.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Ptr:
+		return v.IsZero()
+	}
+	return false
+}
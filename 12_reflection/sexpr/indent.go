@@ -0,0 +1,218 @@
+package sexpr
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// MarshalIndent is like Marshal but lays the output out in the
+// conventional Lisp style, breaking lists that do not fit within
+// width columns over several lines:
+//
+//	((Title "Dr. Strangelove")
+//	 (Year 1964)
+//	 (Actor (("Dr. Strangelove" "Peter Sellers")
+//	         ("Gen. Buck Turgidson" "George C. Scott")))
+//	 (Oscars ("Best Actor (Nomin.)" "Best Adapted Screenplay (Nomin.)"
+//	          "Best Director (Nomin.)" "Best Picture (Nomin.)")))
+//
+// A broken list whose first element is an atom, such as a struct
+// field or map entry, keeps its second element on the first line
+// and aligns the rest beneath it. A broken list of atoms is filled,
+// with as many atoms on each line as fit. Any other broken list puts
+// one element per line, each indented by indent columns relative to
+// the opening parenthesis; an indent of 1 aligns the elements.
+func MarshalIndent(v interface{}, indent, width int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := Indent(&out, buf.Bytes(), indent, width); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Indent appends to dst an indented form of the sequence of
+// S-expressions in src, as described at MarshalIndent, each followed
+// by a newline. Comments in src are not preserved.
+func Indent(dst *bytes.Buffer, src []byte, indent, width int) error {
+	dec := NewDecoder(bytes.NewReader(src))
+	for {
+		n, err := parseNode(dec)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		p := printer{buf: dst, indent: indent, width: width}
+		p.print(n)
+		dst.WriteByte('\n')
+	}
+}
+
+// A node is an S-expression parsed only as far as layout needs:
+// either an atom, kept as text, or a list of nodes.
+type node struct {
+	label  string // datum label #n=, if any
+	atom   string
+	list   []*node
+	isList bool
+	flat   int // length when printed on one line
+}
+
+// parseNode reads the next complete S-expression from dec.
+func parseNode(dec *Decoder) (*node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok := tok.(type) {
+	case StartList:
+		n := &node{isList: true, flat: 2} // "(" and ")"
+		for {
+			if !dec.More() {
+				if _, err := dec.Token(); err != nil { // EndList
+					return nil, err
+				}
+				return n, nil
+			}
+			elem, err := parseNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			if len(n.list) > 0 {
+				n.flat++ // separating space
+			}
+			n.flat += elem.flat
+			n.list = append(n.list, elem)
+		}
+	case Symbol:
+		return atom(string(tok)), nil
+	case String:
+		return atom(strconv.Quote(string(tok))), nil
+	case Int:
+		return atom(string(tok)), nil
+	case Float:
+		return atom(string(tok)), nil
+	case Complex:
+		return atom(fmt.Sprintf("#C(%s %s)", tok.Real, tok.Imag)), nil
+	case Ref:
+		return atom(fmt.Sprintf("#%d#", tok)), nil
+	case Label:
+		n, err := parseNode(dec)
+		if err == io.EOF {
+			return nil, dec.lex.syntaxError("unexpected end of input after label")
+		} else if err != nil {
+			return nil, err
+		}
+		label := fmt.Sprintf("#%d=", tok)
+		n.label = label + n.label
+		n.flat += len(label)
+		return n, nil
+	}
+	return nil, fmt.Errorf("sexpr: unexpected token %v", tok)
+}
+
+func atom(text string) *node { return &node{atom: text, flat: len(text)} }
+
+// allAtoms reports whether every element of list n is an atom.
+func (n *node) allAtoms() bool {
+	for _, elem := range n.list {
+		if elem.isList {
+			return false
+		}
+	}
+	return true
+}
+
+// A printer lays out nodes, tracking the current column.
+type printer struct {
+	buf           *bytes.Buffer
+	col           int
+	indent, width int
+}
+
+func (p *printer) write(s string) {
+	p.buf.WriteString(s)
+	p.col += len(s)
+}
+
+// newline starts a new line indented to column col.
+func (p *printer) newline(col int) {
+	p.buf.WriteByte('\n')
+	p.buf.WriteString(strings.Repeat(" ", col))
+	p.col = col
+}
+
+func (p *printer) print(n *node) {
+	p.write(n.label)
+	if !n.isList {
+		p.write(n.atom)
+		return
+	}
+	if p.col-len(n.label)+n.flat <= p.width || len(n.list) == 0 {
+		p.printList(n)
+		return
+	}
+
+	open := p.col
+	p.write("(")
+	switch {
+	case n.allAtoms(): // fill lines
+		for i, elem := range n.list {
+			if i > 0 {
+				if p.col+1+elem.flat+1 > p.width { // room for ")" too
+					p.newline(open + 1)
+				} else {
+					p.write(" ")
+				}
+			}
+			p.printFlat(elem)
+		}
+	case !n.list[0].isList: // (head second
+		p.print(n.list[0]) //        rest...)
+		p.write(" ")
+		align := p.col
+		for i, elem := range n.list[1:] {
+			if i > 0 {
+				p.newline(align)
+			}
+			p.print(elem)
+		}
+	default:
+		for i, elem := range n.list {
+			if i > 0 {
+				p.newline(open + p.indent)
+			}
+			p.print(elem)
+		}
+	}
+	p.write(")")
+}
+
+func (p *printer) printFlat(n *node) {
+	p.write(n.label)
+	if !n.isList {
+		p.write(n.atom)
+		return
+	}
+	p.printList(n)
+}
+
+// printList prints list n, without its label, on one line.
+func (p *printer) printList(n *node) {
+	p.write("(")
+	for i, elem := range n.list {
+		if i > 0 {
+			p.write(" ")
+		}
+		p.printFlat(elem)
+	}
+	p.write(")")
+}
@@ -0,0 +1,78 @@
+package sexpr
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Interface values are encoded as ("TypeName" value), so that
+// Unmarshal can rebuild a value of the same dynamic type. The
+// registry maps between names and types; as with encoding/gob,
+// types that travel inside interfaces must be registered before
+// they are decoded. The basic types and []interface{} are
+// registered already.
+var registry struct {
+	sync.RWMutex
+	types map[string]reflect.Type
+	names map[reflect.Type]string
+}
+
+// Register records the type of value under the name returned by
+// its reflect.Type's String method, such as "sexpr.Movie".
+func Register(value interface{}) {
+	RegisterName(reflect.TypeOf(value).String(), value)
+}
+
+// RegisterName records the type of value under name.
+// It panics if either the name or the type is already registered
+// differently, which indicates a programming error.
+func RegisterName(name string, value interface{}) {
+	t := reflect.TypeOf(value)
+	if t == nil {
+		panic("sexpr: RegisterName of nil value")
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if u, ok := registry.types[name]; ok && u != t {
+		panic(fmt.Sprintf("sexpr: registering duplicate types for %q: %s != %s", name, u, t))
+	}
+	if n, ok := registry.names[t]; ok && n != name {
+		panic(fmt.Sprintf("sexpr: registering duplicate names for %s: %q != %q", t, n, name))
+	}
+	registry.types[name] = t
+	registry.names[t] = name
+}
+
+// typeName returns the name under which interface values
+// of type t are encoded.
+func typeName(t reflect.Type) string {
+	registry.RLock()
+	defer registry.RUnlock()
+	if name, ok := registry.names[t]; ok {
+		return name
+	}
+	return t.String()
+}
+
+// typeByName returns the type registered under name.
+func typeByName(name string) (reflect.Type, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	t, ok := registry.types[name]
+	return t, ok
+}
+
+func init() {
+	registry.types = make(map[string]reflect.Type)
+	registry.names = make(map[reflect.Type]string)
+	for _, v := range []interface{}{
+		false, "", Symbol(""),
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0), uintptr(0),
+		float32(0), float64(0), complex64(0), complex128(0),
+		[]interface{}(nil),
+	} {
+		Register(v)
+	}
+}
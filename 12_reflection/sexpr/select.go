@@ -0,0 +1,184 @@
+package sexpr
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/scanner"
+)
+
+// A Path selects sub-expressions of a document by the keys that lead
+// to them, much as xmlselect selects XML elements by their names.
+// A path is a sequence of steps, each applied to the expressions
+// selected by the one before, starting from the whole document:
+//
+//   - a symbol, string or integer selects the value of each entry
+//     (key value) of a list whose key is that atom, such as a struct
+//     field or map element;
+//   - * selects every element of a list;
+//   - ** selects an expression and each of its descendants.
+//
+// Label references #n# are not followed.
+type Path struct {
+	steps []step
+}
+
+// A step is a key, written as its atom would be by Indent, or
+// one of the wildcards "*" and "**".
+type step string
+
+// ParsePath parses a path written either as a list of steps
+// or as steps separated by slashes; these are equivalent:
+//
+//	(Actor "Dr. Strangelove")
+//	Actor/"Dr. Strangelove"
+func ParsePath(s string) (*Path, error) {
+	var scan scanner.Scanner
+	scan.Init(strings.NewReader(s))
+	// Not GoTokens: "/*" in a path such as Oscars/* is no comment.
+	scan.Mode = scanner.ScanIdents | scanner.ScanInts | scanner.ScanFloats |
+		scanner.ScanStrings | scanner.ScanRawStrings
+	var err error
+	scan.Error = func(s *scanner.Scanner, msg string) {
+		if err == nil {
+			err = fmt.Errorf("sexpr: invalid path: %s", msg)
+		}
+	}
+	fail := func(format string, args ...interface{}) (*Path, error) {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("sexpr: invalid path %q: %s", s, fmt.Sprintf(format, args...))
+	}
+
+	var p Path
+	tok := scan.Scan()
+	list := tok == '('
+	if list {
+		tok = scan.Scan()
+	}
+	for {
+		if list && tok == ')' && len(p.steps) > 0 {
+			tok = scan.Scan()
+			break
+		}
+		st, ok := parseStep(&scan, tok)
+		if !ok {
+			return fail("unexpected %s", scanner.TokenString(tok))
+		}
+		p.steps = append(p.steps, st)
+		tok = scan.Scan()
+		if !list {
+			if tok != '/' {
+				break
+			}
+			tok = scan.Scan()
+		}
+	}
+	if tok != scanner.EOF {
+		return fail("unexpected %s after path", scanner.TokenString(tok))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// parseStep parses the step that begins with tok.
+func parseStep(scan *scanner.Scanner, tok rune) (step, bool) {
+	switch tok {
+	case scanner.Ident, scanner.Int, scanner.Float:
+		return step(scan.TokenText()), true
+	case scanner.String, scanner.RawString:
+		s, err := strconv.Unquote(scan.TokenText())
+		if err != nil {
+			return "", false
+		}
+		return step(strconv.Quote(s)), true
+	case '-':
+		if scan.Scan() != scanner.Int {
+			return "", false
+		}
+		return step("-" + scan.TokenText()), true
+	case '*':
+		if scan.Peek() == '*' {
+			scan.Scan()
+			return "**", true
+		}
+		return "*", true
+	}
+	return "", false
+}
+
+// String returns p in its list form.
+func (p *Path) String() string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for i, st := range p.steps {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(string(st))
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// Select reads a sequence of S-expression documents from r and calls
+// fn with the text of each sub-expression that matches p, in the
+// order in which they appear, with insignificant white space removed.
+// It stops at the first error, from the input or from fn.
+func (p *Path) Select(r io.Reader, fn func(match []byte) error) error {
+	dec := NewDecoder(r)
+	for {
+		doc, err := parseNode(dec)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		for _, n := range p.match(doc) {
+			var buf bytes.Buffer
+			pr := printer{buf: &buf}
+			pr.printFlat(n)
+			if err := fn(buf.Bytes()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// match returns the sub-expressions of doc selected by p.
+func (p *Path) match(doc *node) []*node {
+	nodes := []*node{doc}
+	for _, st := range p.steps {
+		var next []*node
+		for _, n := range nodes {
+			switch st {
+			case "*":
+				next = append(next, n.list...)
+			case "**":
+				next = n.descendants(next)
+			default:
+				for _, elem := range n.list {
+					if len(elem.list) == 2 && !elem.list[0].isList && elem.list[0].atom == string(st) {
+						next = append(next, elem.list[1])
+					}
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// descendants appends n and its descendants to nodes, in pre-order.
+func (n *node) descendants(nodes []*node) []*node {
+	nodes = append(nodes, n)
+	for _, elem := range n.list {
+		nodes = elem.descendants(nodes)
+	}
+	return nodes
+}
@@ -0,0 +1,203 @@
+package sexpr
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strconv"
+	"text/scanner"
+)
+
+// An Encoder writes a sequence of S-expressions to an output stream.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes the S-expression encoding of v to the stream,
+// followed by a newline.
+func (enc *Encoder) Encode(v interface{}) error {
+	var buf bytes.Buffer
+	if err := encode(&buf, reflect.ValueOf(v)); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := enc.w.Write(buf.Bytes())
+	return err
+}
+
+// A Decoder reads and decodes a sequence of S-expressions from
+// an input stream. Like encoding/json and encoding/xml, it offers
+// both a Decode method that populates a Go variable and a lower
+// level Token method that yields the input one token at a time;
+// the two may be interleaved.
+type Decoder struct {
+	lex   *lexer
+	depth int // number of open lists returned by Token
+}
+
+// NewDecoder returns a new decoder that reads from r.
+// The decoder may buffer data read from r beyond the values
+// requested.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{lex: newLexer(r)}
+}
+
+// Decode reads the next S-expression from its input and stores it
+// in the variable pointed to by out, as described for Unmarshal.
+// At the end of the input it returns io.EOF. Within a list opened
+// by a StartList from Token, use More to know when to stop.
+func (dec *Decoder) Decode(out interface{}) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return &InvalidUnmarshalError{reflect.TypeOf(out)}
+	}
+	lex := dec.lex
+	if err := lex.peek(); err != nil {
+		return err
+	}
+	switch lex.token {
+	case scanner.EOF:
+		if dec.depth > 0 {
+			return lex.syntaxError("unexpected end of input in list")
+		}
+		return io.EOF
+	case ')':
+		return lex.syntaxError("unexpected ')'")
+	}
+	lex.labels = nil // labels are local to a value
+	return read(lex, v.Elem())
+}
+
+// More reports whether there is another value before the end of
+// the input or of the current list.
+func (dec *Decoder) More() bool {
+	if err := dec.lex.peek(); err != nil {
+		return false
+	}
+	return dec.lex.token != scanner.EOF && dec.lex.token != ')'
+}
+
+// A Token holds a value of one of these types:
+// Symbol, String, Int, Float, Complex, Label, Ref,
+// StartList or EndList.
+type Token interface{}
+
+// A String is the unquoted text of a string literal.
+type String string
+
+// An Int is the text of an integer literal, such as "-42" or "0x1f".
+type Int string
+
+// Int64 returns the value of i as an int64.
+func (i Int) Int64() (int64, error) { return strconv.ParseInt(string(i), 0, 64) }
+
+// Uint64 returns the value of i as a uint64.
+func (i Int) Uint64() (uint64, error) { return strconv.ParseUint(string(i), 0, 64) }
+
+// A Float is the text of a floating-point literal, such as "-2.5e3".
+type Float string
+
+// Float64 returns the value of f as a float64.
+func (f Float) Float64() (float64, error) { return strconv.ParseFloat(string(f), 64) }
+
+// A Complex is a complex number literal #C(re im).
+type Complex struct {
+	Real, Imag Float
+}
+
+// Complex128 returns the value of c as a complex128.
+func (c Complex) Complex128() (complex128, error) {
+	re, err := c.Real.Float64()
+	if err != nil {
+		return 0, err
+	}
+	im, err := c.Imag.Float64()
+	if err != nil {
+		return 0, err
+	}
+	return complex(re, im), nil
+}
+
+// A Label is a datum label #n=, naming the value that follows it.
+type Label int
+
+// A Ref is a reference #n# to the value labelled #n=.
+type Ref int
+
+// A StartList is the opening parenthesis of a list.
+type StartList struct{}
+
+// An EndList is the closing parenthesis of a list.
+type EndList struct{}
+
+// Token returns the next token in the input stream.
+// At the end of the input, Token returns nil, io.EOF.
+//
+// Token guarantees that the StartList and EndList tokens it
+// returns are properly nested and matched: an unbalanced closing
+// parenthesis, or the end of input inside a list, is reported as
+// a *SyntaxError.
+func (dec *Decoder) Token() (Token, error) {
+	lex := dec.lex
+	if err := lex.peek(); err != nil {
+		return nil, err
+	}
+	switch lex.token {
+	case scanner.EOF:
+		if dec.depth > 0 {
+			return nil, lex.syntaxError("unexpected end of input in list")
+		}
+		return nil, io.EOF
+	case scanner.Ident:
+		sym := Symbol(lex.text())
+		lex.next()
+		return sym, nil
+	case scanner.String, scanner.RawString:
+		s, err := strconv.Unquote(lex.text())
+		if err != nil {
+			return nil, lex.syntaxError("invalid string %s", lex.text())
+		}
+		lex.next()
+		return String(s), nil
+	case scanner.Int, scanner.Float, '-':
+		text, isInt, err := number(lex)
+		if err != nil {
+			return nil, err
+		}
+		if isInt {
+			return Int(text), nil
+		}
+		return Float(text), nil
+	case '#':
+		re, im, err := complexLit(lex)
+		if err != nil {
+			return nil, err
+		}
+		return Complex{Float(re), Float(im)}, nil
+	case labelDef:
+		n := lex.label()
+		lex.next()
+		return Label(n), nil
+	case labelRef:
+		n := lex.label()
+		lex.next()
+		return Ref(n), nil
+	case '(':
+		dec.depth++
+		lex.next()
+		return StartList{}, nil
+	case ')':
+		if dec.depth == 0 {
+			return nil, lex.syntaxError("unexpected ')'")
+		}
+		dec.depth--
+		lex.next()
+		return EndList{}, nil
+	}
+	return nil, lex.syntaxError("unexpected %s", lex.describe())
+}
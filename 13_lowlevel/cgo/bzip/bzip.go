@@ -1,4 +1,5 @@
-// Package bzip provides a writer that uses bzip2 compression
+// Package bzip provides a writer and a reader for bzip2-compressed
+// streams, using the C library libbzip2.
 package bzip
 
 /*
@@ -14,76 +15,191 @@ void bz2free(bz_stream* s) { free(s); }
 import "C"
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"unsafe"
 )
 
-type writer struct {
+// Errors reported by libbzip2.
+var (
+	ErrData   = errors.New("bzip: data integrity error")
+	ErrMagic  = errors.New("bzip: not a bzip2 stream")
+	ErrMemory = errors.New("bzip: out of memory")
+	ErrConfig = errors.New("bzip: libbzip2 miscompiled")
+)
+
+// ErrClosed is returned when a Writer, or a reader returned by
+// NewReader, is used after Close.
+var ErrClosed = errors.New("bzip: use of closed stream")
+
+// codeError returns the Go error for the libbzip2 return code r,
+// or nil if it is not an error. Parameter and sequence errors are
+// mistakes of this package, so they are reported as such.
+func codeError(r C.int) error {
+	switch r {
+	case C.BZ_OK, C.BZ_RUN_OK, C.BZ_FLUSH_OK, C.BZ_FINISH_OK, C.BZ_STREAM_END:
+		return nil
+	case C.BZ_DATA_ERROR:
+		return ErrData
+	case C.BZ_DATA_ERROR_MAGIC:
+		return ErrMagic
+	case C.BZ_MEM_ERROR:
+		return ErrMemory
+	case C.BZ_CONFIG_ERROR:
+		return ErrConfig
+	}
+	return fmt.Errorf("bzip: internal error: libbzip2 returned %d", int(r))
+}
+
+// Compression levels, which are the sizes of the blocks compressed
+// independently, in units of 100k: a lower level uses less memory,
+// in compressing and decompressing, but compresses less well.
+const (
+	BestSpeed          = 1
+	BestCompression    = 9
+	DefaultCompression = -1 // BestCompression
+)
+
+// A Writer is an io.WriteCloser that compresses the data written to
+// it. It must be closed to free the memory held by libbzip2.
+type Writer struct {
 	w      io.Writer // underlying output stream
+	level  int
 	stream *C.bz_stream
 	outbuf [64 * 1024]byte
+	err    error // sticky error from libbzip2 or w
+}
+
+// NewWriter returns a writer for bzip2-compressed streams,
+// or an error if libbzip2 cannot set up the stream.
+func NewWriter(out io.Writer) (*Writer, error) {
+	return NewWriterLevel(out, DefaultCompression)
 }
 
-// NewWriter returns a writer for bzip2-compressed streams.
-func NewWriter(out io.Writer) io.WriteCloser {
+// NewWriterLevel is like NewWriter but compresses at the given level,
+// from BestSpeed to BestCompression, or DefaultCompression.
+func NewWriterLevel(out io.Writer, level int) (*Writer, error) {
+	if level == DefaultCompression {
+		level = BestCompression
+	}
+	if level < BestSpeed || level > BestCompression {
+		return nil, fmt.Errorf("bzip: invalid compression level: %d", level)
+	}
+	w := &Writer{w: out, level: level, stream: C.bz2alloc()}
+	if err := w.init(); err != nil {
+		C.bz2free(w.stream)
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) init() error {
 	const (
-		blockSize  = 9
 		verbosity  = 0
 		workFactor = 30
 	)
-	w := &writer{w: out, stream: C.bz2alloc()}
-	C.BZ2_bzCompressInit(w.stream, blockSize, verbosity, workFactor)
-	return w
+	return codeError(C.BZ2_bzCompressInit(w.stream, C.int(w.level), verbosity, workFactor))
 }
 
 // Write feeds the uncompressed `data` to the compressor,
 // calling `bz2compress` until all data has been consumed.
-func (w *writer) Write(data []byte) (int, error) {
+// It returns ErrClosed after Close.
+func (w *Writer) Write(data []byte) (int, error) {
 	if w.stream == nil {
-		panic("closed")
+		return 0, ErrClosed
+	}
+	if w.err != nil {
+		return 0, w.err
 	}
 	var total int // uncompressed bytes written
 	for len(data) > 0 {
 		inlen, outlen := C.uint(len(data)), C.uint(cap(w.outbuf))
-		C.bz2compress(w.stream, C.BZ_RUN,
+		r := C.bz2compress(w.stream, C.BZ_RUN,
 			(*C.char)(unsafe.Pointer(&data[0])), &inlen,
 			(*C.char)(unsafe.Pointer(&w.outbuf)), &outlen)
+		if w.err = codeError(r); w.err != nil {
+			return total, w.err
+		}
 		total += int(inlen)
 		data = data[inlen:]
-		if _, err := w.w.Write(w.outbuf[:outlen]); err != nil {
-			return total, err
+		if _, w.err = w.w.Write(w.outbuf[:outlen]); w.err != nil {
+			return total, w.err
 		}
 	}
 	return total, nil
 }
 
+// Flush ends the current block, as BZ_FLUSH does, and writes it out,
+// so that the data written so far need not wait for a block to fill
+// before it reaches the underlying writer. As blocks are not aligned
+// to bytes, the last few bits stay buffered until more is written or
+// w is closed, and a reader cannot decompress the block until it has
+// those. Flushing often makes compression worse.
+func (w *Writer) Flush() error {
+	if w.stream == nil {
+		return ErrClosed
+	}
+	if w.err == nil {
+		w.err = w.drain(C.BZ_FLUSH, C.BZ_RUN_OK)
+	}
+	return w.err
+}
+
 // Close flushes out any remaining compressed data
 // from the stream's output buffer.
 // It closes the stream but not the underlying io.Writer.
-func (w *writer) Close() error {
+// Closing a closed Writer has no effect.
+func (w *Writer) Close() error {
 	if w.stream == nil {
-		panic("closed")
+		return nil
 	}
+	// Since w.stream pointer is no longer safe to dereference,
+	// we set it to nil to be defensive and add explicit nil checks.
 	defer func() {
 		C.BZ2_bzCompressEnd(w.stream)
 		C.bz2free(w.stream)
 		w.stream = nil
 	}()
+	if w.err == nil {
+		w.err = w.drain(C.BZ_FINISH, C.BZ_STREAM_END)
+	}
+	return w.err
+}
+
+// drain calls `bz2compress` with action and no further input,
+// writing out its output, until it returns done.
+func (w *Writer) drain(action, done C.int) error {
 	for {
 		inlen, outlen := C.uint(0), C.uint(cap(w.outbuf))
-		r := C.bz2compress(w.stream, C.BZ_FINISH, nil, &inlen,
+		r := C.bz2compress(w.stream, action, nil, &inlen,
 			(*C.char)(unsafe.Pointer(&w.outbuf)), &outlen)
+		if err := codeError(r); err != nil {
+			return err
+		}
 		if _, err := w.w.Write(w.outbuf[:outlen]); err != nil {
 			return err
 		}
-		// Since w.stream poiter is no longer safe to dereference,
-		// we set it to nil to be defencisive and add explicit nil checks.
-		if r == C.BZ_STREAM_END {
+		if r == done {
 			return nil
 		}
 	}
 }
 
+// Reset discards the state of w, including any data not yet flushed,
+// and makes it write a new stream to out at the same level, as if
+// just created by NewWriterLevel but reusing its libbzip2 stream,
+// unless w was closed, in which case it allocates a new one.
+func (w *Writer) Reset(out io.Writer) {
+	if w.stream == nil {
+		w.stream = C.bz2alloc()
+	} else {
+		C.BZ2_bzCompressEnd(w.stream)
+	}
+	w.w = out
+	w.err = w.init()
+}
+
 /*
 //Example usage
 
@@ -95,7 +211,10 @@ import (
 	"url/bzip"
 )
 func main() {
-	w := bzip.NewWriter(os.Stdout)
+	w, err := bzip.NewWriter(os.Stdout)
+	if err != nil {
+		log.Fatalf("bzipper: %v\n", err)
+	}
 	if _, err := io.Copy(w, os.Stdin); err != nil {
 		log.Fatalf("bzipper: %v\n", err)
 	}
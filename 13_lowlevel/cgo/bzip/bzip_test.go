@@ -0,0 +1,328 @@
+package bzip
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+)
+
+// testData returns n bytes of text, compressible but not trivially.
+func testData(n int) []byte {
+	rng := rand.New(rand.NewSource(1))
+	words := []string{"the", "quick", "brown", "fox", "jumps", "over", "lazy", "dog", "\n"}
+	var buf bytes.Buffer
+	for buf.Len() < n {
+		buf.WriteString(words[rng.Intn(len(words))])
+		buf.WriteByte(' ')
+		if rng.Intn(10) == 0 {
+			fmt.Fprintf(&buf, "%d ", rng.Int())
+		}
+	}
+	return buf.Bytes()[:n]
+}
+
+// compress returns data compressed by a Writer.
+func compress(t testing.TB, data []byte) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 1, 1000, 2 << 20} { // up to several blocks
+		data := testData(n)
+		z := compress(t, data)
+
+		// The standard library agrees with libbzip2.
+		got, err := io.ReadAll(bzip2.NewReader(bytes.NewReader(z)))
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("compress/bzip2 read of %d bytes: got %d bytes, %v", n, len(got), err)
+		}
+
+		// So does our reader, however its input arrives.
+		for _, in := range []struct {
+			name string
+			r    io.Reader
+		}{
+			{"whole", bytes.NewReader(z)},
+			{"bytewise", iotest.OneByteReader(bytes.NewReader(z))},
+			{"with error at EOF", iotest.DataErrReader(bytes.NewReader(z))},
+		} {
+			r := NewReader(in.r)
+			got, err := io.ReadAll(r)
+			if err != nil || !bytes.Equal(got, data) {
+				t.Errorf("%s read of %d bytes: got %d bytes, %v", in.name, n, len(got), err)
+			}
+			if err := r.Close(); err != nil {
+				t.Errorf("Close: %v", err)
+			}
+		}
+	}
+}
+
+func TestReaderSmallBuffer(t *testing.T) {
+	data := testData(100000)
+	r := NewReader(bytes.NewReader(compress(t, data)))
+	defer r.Close()
+	got, err := io.ReadAll(iotest.OneByteReader(r))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("bytewise read: got %d bytes, %v", len(got), err)
+	}
+}
+
+func TestReaderMultistream(t *testing.T) {
+	a, b := testData(5000), []byte("and then some")
+	z := append(compress(t, a), compress(t, b)...)
+	r := NewReader(bytes.NewReader(z))
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if want := append(a, b...); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("read of two streams: got %d bytes, %v; want %d bytes", len(got), err, len(want))
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	z := compress(t, testData(10000))
+	corrupt := append([]byte(nil), z...)
+	corrupt[len(corrupt)/2] ^= 0xff
+
+	for _, test := range []struct {
+		name string
+		in   []byte
+		want error
+	}{
+		{"empty", nil, io.ErrUnexpectedEOF},
+		{"truncated", z[:len(z)/2], io.ErrUnexpectedEOF},
+		{"corrupt", corrupt, ErrData},
+		{"not bzip2", []byte("hello, world"), ErrMagic},
+		{"trailing garbage", append(append([]byte(nil), z...), "garbage"...), ErrMagic},
+	} {
+		r := NewReader(bytes.NewReader(test.in))
+		_, err := io.ReadAll(r)
+		if err != test.want {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.want)
+		}
+		// Errors are sticky.
+		if _, err2 := r.Read(make([]byte, 1)); err2 != err {
+			t.Errorf("%s: second Read gave %v, first %v", test.name, err2, err)
+		}
+		r.Close()
+	}
+}
+
+func TestWriterLevel(t *testing.T) {
+	data := testData(300000)
+	var sizes []int
+	for _, level := range []int{BestSpeed, 5, BestCompression, DefaultCompression} {
+		var buf bytes.Buffer
+		w, err := NewWriterLevel(&buf, level)
+		if err != nil {
+			t.Fatalf("NewWriterLevel(%d): %v", level, err)
+		}
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			t.Fatalf("level %d: Close: %v", level, err)
+		}
+		sizes = append(sizes, buf.Len())
+		got, err := io.ReadAll(bzip2.NewReader(&buf))
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("level %d: got %d bytes, %v", level, len(got), err)
+		}
+	}
+	if !(sizes[0] > sizes[2] && sizes[2] == sizes[3]) {
+		t.Errorf("compressed sizes at levels 1, 5, 9 and default: %v", sizes)
+	}
+	for _, level := range []int{0, 10, -2} {
+		if _, err := NewWriterLevel(io.Discard, level); err == nil {
+			t.Errorf("NewWriterLevel(%d) succeeded", level)
+		}
+	}
+}
+
+func TestFlush(t *testing.T) {
+	data := testData(5000)
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.Write(data)
+	before := buf.Len() // just the header: the block is far from full
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if before > 4 || buf.Len() < 1000 {
+		t.Errorf("Flush wrote out %d bytes after %d: want the compressed block", buf.Len(), before)
+	}
+
+	// The stream carries on after the flush.
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []io.Reader{bzip2.NewReader(bytes.NewReader(buf.Bytes())), NewReader(&buf)} {
+		got, err := io.ReadAll(r)
+		if want := append(data, data...); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("after Flush and Close: got %d bytes, %v; want %d bytes", len(got), err, len(want))
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	var bufs [3]bytes.Buffer
+	w, _ := NewWriterLevel(&bufs[0], BestSpeed)
+	w.Write([]byte("discarded"))
+	for i := range bufs {
+		if i == 2 {
+			w.Close() // Reset also works after Close.
+		}
+		w.Reset(&bufs[i])
+		fmt.Fprintf(w, "file %d", i)
+		if err := w.Close(); err != nil {
+			t.Fatalf("file %d: Close: %v", i, err)
+		}
+	}
+	for i := range bufs {
+		got, err := io.ReadAll(bzip2.NewReader(&bufs[i]))
+		if want := fmt.Sprintf("file %d", i); err != nil || string(got) != want {
+			t.Errorf("file %d: got %q, %v; want %q", i, got, err, want)
+		}
+	}
+}
+
+func TestClosed(t *testing.T) {
+	w, err := NewWriter(io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("x")); err != ErrClosed {
+		t.Errorf("Write after Close: got %v, want ErrClosed", err)
+	}
+	if err := w.Flush(); err != ErrClosed {
+		t.Errorf("Flush after Close: got %v, want ErrClosed", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+
+	r := NewReader(bytes.NewReader(compress(t, []byte("x"))))
+	r.Close()
+	if _, err := r.Read(make([]byte, 1)); err != ErrClosed {
+		t.Errorf("Read after Close: got %v, want ErrClosed", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+func TestParallelWriter(t *testing.T) {
+	const level = BestSpeed // blocks of 100000 bytes
+	for _, size := range []int{0, 10, 100000, 250000, 1000000} {
+		for _, n := range []int{1, 4} {
+			data := testData(size)
+			var buf bytes.Buffer
+			w, err := NewParallelWriter(&buf, level, n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Write in pieces that straddle the blocks.
+			for p := data; len(p) > 0; {
+				k := 30001
+				if k > len(p) {
+					k = len(p)
+				}
+				if _, err := w.Write(p[:k]); err != nil {
+					t.Fatalf("Write: %v", err)
+				}
+				p = p[k:]
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			z := buf.Bytes()
+			for name, r := range map[string]io.Reader{
+				"compress/bzip2": bzip2.NewReader(bytes.NewReader(z)),
+				"NewReader":      NewReader(bytes.NewReader(z)),
+			} {
+				got, err := io.ReadAll(r)
+				if err != nil || !bytes.Equal(got, data) {
+					t.Errorf("%d bytes on %d goroutines, read by %s: got %d bytes, %v",
+						size, n, name, len(got), err)
+				}
+			}
+		}
+	}
+}
+
+// failWriter fails after its first write.
+type failWriter struct{ writes int }
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	if w.writes++; w.writes > 1 {
+		return 0, io.ErrShortWrite
+	}
+	return len(p), nil
+}
+
+func TestParallelWriterErrors(t *testing.T) {
+	if _, err := NewParallelWriter(io.Discard, 10, 1); err == nil {
+		t.Errorf("NewParallelWriter at level 10 succeeded")
+	}
+
+	w, _ := NewParallelWriter(new(failWriter), BestSpeed, 2)
+	data := testData(1000000)
+	_, err := w.Write(data)
+	if err2 := w.Close(); err == nil {
+		err = err2
+	}
+	if err != io.ErrShortWrite {
+		t.Errorf("writing to a failing writer: got %v, want io.ErrShortWrite", err)
+	}
+	if _, err := w.Write(data); err != ErrClosed {
+		t.Errorf("Write after Close: got %v, want ErrClosed", err)
+	}
+}
+
+var benchData = testData(8 << 20)
+
+func BenchmarkWriter(b *testing.B) {
+	b.SetBytes(int64(len(benchData)))
+	for i := 0; i < b.N; i++ {
+		w, _ := NewWriter(io.Discard)
+		w.Write(benchData)
+		w.Close()
+	}
+}
+
+func BenchmarkParallelWriter(b *testing.B) {
+	for _, n := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			b.SetBytes(int64(len(benchData)))
+			for i := 0; i < b.N; i++ {
+				w, _ := NewParallelWriter(io.Discard, DefaultCompression, n)
+				w.Write(benchData)
+				w.Close()
+			}
+		})
+	}
+}
+
+// $ go test -run=NONE -bench=. $GOPATH/13_lowlevel/cgo/bzip
@@ -0,0 +1,166 @@
+package bzip
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// A ParallelWriter is an io.WriteCloser that compresses the data
+// written to it on several goroutines at once. It splits the data
+// into blocks of the size of the compression level, compresses each
+// as a bzip2 stream of its own, with its own bz_stream, and writes
+// the streams out in order, one after the other, as does pbzip2.
+// bzip2, compress/bzip2 and NewReader all decompress the result to
+// the data written. Like a Writer, it must be closed, and it is not
+// safe for concurrent use.
+type ParallelWriter struct {
+	level  int
+	size   int    // of a block
+	buf    []byte // the block being filled
+	blocks int    // number of blocks started
+	closed bool
+
+	sem   chan struct{}    // held by each goroutine compressing a block
+	queue chan chan result // results of blocks in order, once available
+	done  chan struct{}    // closed when the output goroutine is done
+
+	mu  sync.Mutex
+	err error // first error compressing or writing out a block
+}
+
+// A result is a compressed block, or the error compressing it.
+type result struct {
+	data []byte
+	err  error
+}
+
+// NewParallelWriter returns a ParallelWriter that writes to out at
+// the given level, as for NewWriterLevel, using at most n goroutines
+// to compress; if n is zero or less, it uses runtime.GOMAXPROCS(0).
+// Blocks are 100k times level bytes; besides the block being filled,
+// at most n+1 are held in memory at once, compressed or not.
+func NewParallelWriter(out io.Writer, level, n int) (*ParallelWriter, error) {
+	if level == DefaultCompression {
+		level = BestCompression
+	}
+	if level < BestSpeed || level > BestCompression {
+		return nil, fmt.Errorf("bzip: invalid compression level: %d", level)
+	}
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	w := &ParallelWriter{
+		level: level,
+		size:  level * 100000,
+		sem:   make(chan struct{}, n),
+		queue: make(chan chan result, n),
+		done:  make(chan struct{}),
+	}
+	go w.output(out)
+	return w, nil
+}
+
+// Write copies data into blocks, compressing each as it fills.
+// It reports an error in compressing or writing out a previous block.
+// It returns ErrClosed after Close.
+func (w *ParallelWriter) Write(data []byte) (int, error) {
+	if w.closed {
+		return 0, ErrClosed
+	}
+	var total int // uncompressed bytes written
+	for len(data) > 0 {
+		if err := w.error(); err != nil {
+			return total, err
+		}
+		if w.buf == nil {
+			w.buf = make([]byte, 0, w.size)
+		}
+		n := copy(w.buf[len(w.buf):cap(w.buf)], data)
+		w.buf = w.buf[:len(w.buf)+n]
+		total += n
+		data = data[n:]
+		if len(w.buf) == cap(w.buf) {
+			w.start()
+		}
+	}
+	return total, nil
+}
+
+// start starts compressing the block in w.buf,
+// waiting if n blocks are being compressed already.
+func (w *ParallelWriter) start() {
+	data, level := w.buf, w.level
+	w.buf = nil
+	w.blocks++
+	ch := make(chan result, 1)
+	w.sem <- struct{}{}
+	w.queue <- ch
+	go func() {
+		defer func() { <-w.sem }()
+		ch <- compressBlock(data, level)
+	}()
+}
+
+// compressBlock returns data compressed as a bzip2 stream.
+func compressBlock(data []byte, level int) result {
+	var buf bytes.Buffer
+	zw, err := NewWriterLevel(&buf, level)
+	if err != nil {
+		return result{err: err}
+	}
+	if _, err := zw.Write(data); err != nil {
+		zw.Close()
+		return result{err: err}
+	}
+	if err := zw.Close(); err != nil {
+		return result{err: err}
+	}
+	return result{data: buf.Bytes()}
+}
+
+// output writes the compressed blocks to out in order.
+// After an error, it discards them.
+func (w *ParallelWriter) output(out io.Writer) {
+	defer close(w.done)
+	for ch := range w.queue {
+		r := <-ch
+		if w.error() != nil {
+			continue
+		}
+		if r.err == nil {
+			_, r.err = out.Write(r.data)
+		}
+		if r.err != nil {
+			w.mu.Lock()
+			w.err = r.err
+			w.mu.Unlock()
+		}
+	}
+}
+
+func (w *ParallelWriter) error() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Close compresses the last, partial block, waits for all the blocks
+// to be written out, and reports the first error in doing so.
+// An empty input gives an empty bzip2 stream.
+// It does not close the underlying io.Writer.
+// Closing a closed ParallelWriter has no effect.
+func (w *ParallelWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if len(w.buf) > 0 || w.blocks == 0 {
+		w.start()
+	}
+	close(w.queue)
+	<-w.done
+	return w.error()
+}
@@ -0,0 +1,115 @@
+package bzip
+
+/*
+#cgo CFLAGS: -I/usr/include
+#cgo LDFLAGS: -L/usr/lib -lbz2
+#include <bzlib.h>
+bz_stream* bz2alloc();
+int bz2decompress(bz_stream *s,
+								char *in, unsigned *inlen, char *out, unsigned *outlen);
+void bz2free(bz_stream* s);
+*/
+import "C"
+
+import (
+	"io"
+	"unsafe"
+)
+
+type reader struct {
+	r      io.Reader // underlying input stream
+	stream *C.bz_stream
+	inbuf  [64 * 1024]byte
+	in     []byte // unconsumed part of inbuf
+	inErr  error  // error from r, reported once in is consumed
+	end    bool   // at the end of a bzip2 stream
+	err    error  // sticky error
+}
+
+// NewReader returns a reader that decompresses the bzip2-compressed
+// data read from in. As with bzip2 itself, in may hold several
+// compressed streams one after the other, which decompress to the
+// concatenation of their contents. Corrupt input gives ErrData or
+// ErrMagic, and input that ends within a stream io.ErrUnexpectedEOF.
+// The reader must be closed to free the memory held by libbzip2;
+// closing it does not close in.
+func NewReader(in io.Reader) io.ReadCloser {
+	r := &reader{r: in, stream: C.bz2alloc()}
+	r.err = r.init()
+	return r
+}
+
+func (r *reader) init() error {
+	const (
+		verbosity = 0
+		small     = 0 // use the faster algorithm, which needs more memory
+	)
+	return codeError(C.BZ2_bzDecompressInit(r.stream, verbosity, small))
+}
+
+// Read decompresses into p, calling `bz2decompress` until
+// some output is produced or the input is exhausted.
+func (r *reader) Read(p []byte) (int, error) {
+	if r.stream == nil {
+		return 0, ErrClosed
+	}
+	if len(p) == 0 {
+		return 0, r.err
+	}
+	for r.err == nil {
+		if len(r.in) == 0 && r.inErr == nil {
+			var n int
+			n, r.inErr = r.r.Read(r.inbuf[:])
+			r.in = r.inbuf[:n]
+		}
+		if r.end {
+			// The stream has ended; another may follow.
+			if len(r.in) == 0 {
+				r.err = r.inErr // io.EOF at the end of the input; if nil, read on
+				continue
+			}
+			C.BZ2_bzDecompressEnd(r.stream)
+			if r.err = r.init(); r.err != nil {
+				break
+			}
+			r.end = false
+		}
+
+		var in *C.char
+		if len(r.in) > 0 {
+			in = (*C.char)(unsafe.Pointer(&r.in[0]))
+		}
+		inlen, outlen := C.uint(len(r.in)), C.uint(len(p))
+		ret := C.bz2decompress(r.stream, in, &inlen,
+			(*C.char)(unsafe.Pointer(&p[0])), &outlen)
+		r.in = r.in[inlen:]
+		switch {
+		case ret == C.BZ_STREAM_END:
+			r.end = true
+		case ret != C.BZ_OK:
+			r.err = codeError(ret)
+		case outlen == 0 && len(r.in) == 0 && r.inErr != nil:
+			r.err = r.inErr // input ended within the stream
+			if r.err == io.EOF {
+				r.err = io.ErrUnexpectedEOF
+			}
+		}
+		if outlen > 0 {
+			return int(outlen), nil // any error is reported by the next call
+		}
+	}
+	return 0, r.err
+}
+
+// Close frees the memory held by libbzip2.
+// It does not close the underlying io.Reader.
+// Closing a closed reader has no effect.
+func (r *reader) Close() error {
+	if r.stream == nil {
+		return nil
+	}
+	C.BZ2_bzDecompressEnd(r.stream)
+	C.bz2free(r.stream)
+	r.stream = nil
+	return nil
+}
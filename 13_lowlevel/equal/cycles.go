@@ -0,0 +1,130 @@
+package equal
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"unsafe"
+
+	"gopl.io/ch12/format"
+)
+
+// IsCyclic reports whether x contains a cycle of pointers, maps or
+// slices, on which a recursive encoder such as json.Marshal would
+// never terminate.
+func IsCyclic(x interface{}) bool {
+	f := &cycleFinder{firstOnly: true}
+	f.walk("x", reflect.ValueOf(x))
+	return len(f.cycles) > 0
+}
+
+// FindCycles returns the cycles of pointers, maps and slices in x.
+// Each is given as the paths, in the notation of display.Display with
+// x as the root, of the references that form it, in order, the last
+// referring to the value referred to by the first, as in
+//
+//	[x (*x).tail (*(*x).tail).tail]
+//
+// for a list x whose second element links back to the first.
+// A reference is walked only once, so where cycles share references
+// only those found first are complete; there is one cycle for each
+// reference that closes one. Map keys are not walked.
+func FindCycles(x interface{}) [][]string {
+	f := new(cycleFinder)
+	f.walk("x", reflect.ValueOf(x))
+	return f.cycles
+}
+
+// A cycleFinder holds the state of a depth-first walk for cycles.
+type cycleFinder struct {
+	firstOnly bool              // stop at the first cycle
+	active    map[reference]int // references being walked, by depth
+	done      map[reference]bool
+	stack     []string // paths of active references
+	cycles    [][]string
+}
+
+// A reference identifies the referent of a pointer, map or slice.
+// As in a comparison, the type distinguishes a struct from its first
+// field; the length a slice from a shorter one sharing its array.
+type reference struct {
+	p   unsafe.Pointer
+	t   reflect.Type
+	len int
+}
+
+func (f *cycleFinder) walk(path string, v reflect.Value) {
+	if f.firstOnly && len(f.cycles) > 0 {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if v.IsNil() || v.Kind() != reflect.Ptr && v.Len() == 0 {
+			return
+		}
+		r := reference{unsafe.Pointer(v.Pointer()), v.Type(), 0}
+		if v.Kind() == reflect.Slice {
+			r.len = v.Len()
+		}
+		if i, ok := f.active[r]; ok {
+			cycle := append(append([]string(nil), f.stack[i:]...), path)
+			f.cycles = append(f.cycles, cycle)
+			return
+		}
+		if f.done[r] {
+			return
+		}
+		if f.active == nil {
+			f.active = make(map[reference]int)
+			f.done = make(map[reference]bool)
+		}
+		f.active[r] = len(f.stack)
+		f.stack = append(f.stack, path)
+		defer func() {
+			f.stack = f.stack[:len(f.stack)-1]
+			delete(f.active, r)
+			f.done[r] = true
+		}()
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		f.walk(fmt.Sprintf("(*%s)", path), v.Elem())
+	case reflect.Interface:
+		if !v.IsNil() {
+			f.walk(path+".value", v.Elem())
+		}
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			f.walk(fmt.Sprintf("%s[%d]", path, i), v.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f.walk(fmt.Sprintf("%s.%s", path, v.Type().Field(i).Name), v.Field(i))
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		texts := make([]string, len(keys))
+		for i, key := range keys {
+			texts[i] = format.Atom(key)
+		}
+		sort.Sort(byText{keys, texts})
+		for i, key := range keys {
+			f.walk(fmt.Sprintf("%s[%s]", path, texts[i]), v.MapIndex(key))
+		}
+	}
+}
+
+// byText sorts map keys by their formatted text, so that cycles
+// are found in the same order each time.
+type byText struct {
+	keys  []reflect.Value
+	texts []string
+}
+
+func (b byText) Len() int           { return len(b.keys) }
+func (b byText) Less(i, j int) bool { return b.texts[i] < b.texts[j] }
+func (b byText) Swap(i, j int) {
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+	b.texts[i], b.texts[j] = b.texts[j], b.texts[i]
+}
@@ -1,11 +1,153 @@
+// Package equal provides a deep equivalence relation for arbitrary values.
 package equal
 
 import (
+	"math"
 	"reflect"
+	"strconv"
 	"unsafe"
+
+	"gopl.io/ch12/format"
 )
 
-func equal(x, y reflect.Value, seen map[comparison]bool) bool {
+// Options control how values are compared. The zero Options give the
+// relation of Equal.
+type Options struct {
+	// StrictNil makes a nil slice or map differ from an empty one.
+	StrictNil bool
+
+	// Epsilon is the tolerance within which floating-point numbers,
+	// and the parts of complex ones, are equal: x and y are equal if
+	// they differ by at most Epsilon, or by at most Epsilon times the
+	// larger of their magnitudes. Infinities equal only themselves.
+	Epsilon float64
+
+	// NaNEqual makes NaNs equal to each other.
+	NaNEqual bool
+
+	// IgnoreFields names struct fields left out of the comparison,
+	// either alone, as in "ID", to ignore every field of that name,
+	// or qualified by the type of the struct as reflect writes it,
+	// as in "image.Point.X".
+	IgnoreFields []string
+
+	// Comparators decide the equality of values of their types,
+	// in place of the deep comparison.
+	Comparators []Comparator
+}
+
+// A Comparator decides the equality of values of one type,
+// for use in Options.
+type Comparator struct {
+	t reflect.Type
+	f func(x, y reflect.Value) bool
+}
+
+// Compare returns a Comparator that calls f to compare values of
+// type T, as in Compare(time.Time.Equal). It is not called on values
+// that cannot be read without an address, which is to say values of
+// unexported fields held in maps or interfaces; those are compared
+// deeply.
+func Compare[T any](f func(x, y T) bool) Comparator {
+	return Comparator{
+		t: reflect.TypeOf((*T)(nil)).Elem(),
+		f: func(x, y reflect.Value) bool {
+			a, _ := x.Interface().(T) // nil if T is an interface type
+			b, _ := y.Interface().(T)
+			return f(a, b)
+		},
+	}
+}
+
+// Equal reports whether x and y are deeply equal.
+// Unlike reflect.DeepEqual, it treats a nil slice or map as equal to
+// an empty one, and two cyclic values as equal if their unrolled
+// structures would be.
+// Impl: it must call `reflect.ValueOf` on its arguments.
+func Equal(x, y interface{}) bool {
+	return Options{}.Equal(x, y)
+}
+
+// Equal reports whether x and y are deeply equal under o.
+func (o Options) Equal(x, y interface{}) bool {
+	s := o.state(false)
+	return s.equal(addressable(x), addressable(y))
+}
+
+// Difference reports the path at which x and y first differ, in the
+// notation of display.Display with x as the root, as in (*x).Items[2],
+// and true; or "" and false if they are deeply equal under o.
+func (o Options) Difference(x, y interface{}) (string, bool) {
+	s := o.state(true)
+	if s.equal(addressable(x), addressable(y)) {
+		return "", false
+	}
+	path := "x"
+	for i := len(s.trail) - 1; i >= 0; i-- {
+		if s.trail[i] == "*" {
+			path = "(*" + path + ")"
+		} else {
+			path += s.trail[i]
+		}
+	}
+	return path, true
+}
+
+// addressable returns a reflect.Value for a copy of x that is
+// addressable, as are then its fields and elements, so that they can
+// be recorded by address and passed to comparators even if unexported.
+func addressable(x interface{}) reflect.Value {
+	v := reflect.ValueOf(x)
+	if !v.IsValid() {
+		return v
+	}
+	p := reflect.New(v.Type()).Elem()
+	p.Set(v)
+	return p
+}
+
+// A state holds the state of a single comparison.
+type state struct {
+	opts    *Options
+	seen    map[comparison]bool
+	compare map[reflect.Type]func(x, y reflect.Value) bool
+	ignore  map[string]bool
+	trace   bool     // whether to record the trail
+	trail   []string // steps from the first difference back to the root
+}
+
+type comparison struct {
+	x, y unsafe.Pointer
+	t    reflect.Type
+}
+
+func (o *Options) state(trace bool) *state {
+	s := &state{opts: o, seen: make(map[comparison]bool), trace: trace}
+	if len(o.Comparators) > 0 {
+		s.compare = make(map[reflect.Type]func(x, y reflect.Value) bool)
+		for _, c := range o.Comparators {
+			s.compare[c.t] = c.f
+		}
+	}
+	if len(o.IgnoreFields) > 0 {
+		s.ignore = make(map[string]bool)
+		for _, name := range o.IgnoreFields {
+			s.ignore[name] = true
+		}
+	}
+	return s
+}
+
+// step records, on the way back from a difference, the step to it
+// from the value being compared: a selector, an index, or * for
+// indirection.
+func (s *state) step(st string) {
+	if s.trace {
+		s.trail = append(s.trail, st)
+	}
+}
+
+func (s *state) equal(x, y reflect.Value) bool {
 	if !x.IsValid() || !y.IsValid() {
 		return x.IsValid() == y.IsValid()
 	}
@@ -15,17 +157,28 @@ func equal(x, y reflect.Value, seen map[comparison]bool) bool {
 
 	// Cycle check: to ensure termination even for
 	// cyclic structures, completed comparisons must be recorded.
-	if x.CanAddr() && y.CanAddr() {
-		xptr := unsafe.Pointer(x.UnsafeAddr())
-		yptr := unsafe.Pointer(y.UnsafeAddr())
-		if xptr == yptr {
+	// Maps are recorded by reference, as their elements have no address.
+	var c comparison
+	switch {
+	case x.Kind() == reflect.Map:
+		c = comparison{unsafe.Pointer(x.Pointer()), unsafe.Pointer(y.Pointer()), x.Type()}
+	case x.CanAddr() && y.CanAddr():
+		c = comparison{unsafe.Pointer(x.UnsafeAddr()), unsafe.Pointer(y.UnsafeAddr()), x.Type()}
+	}
+	if c.t != nil {
+		if c.x == c.y && c.x != nil {
 			return true // identical references
 		}
-		c := comparison{xptr, yptr, x.Type()}
-		if seen[c] {
+		if s.seen[c] {
 			return true // already seen
 		}
-		seen[c] = true
+		s.seen[c] = true
+	}
+
+	if f := s.compare[x.Type()]; f != nil {
+		if x, y, ok := readable(x, y); ok {
+			return f(x, y)
+		}
 	}
 
 	switch x.Kind() {
@@ -34,41 +187,115 @@ func equal(x, y reflect.Value, seen map[comparison]bool) bool {
 	case reflect.String:
 		return x.String() == y.String()
 
-		// ... numeric cases omitted for brevity...
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return x.Int() == y.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return x.Uint() == y.Uint()
+	case reflect.Float32, reflect.Float64:
+		return s.floats(x.Float(), y.Float())
+	case reflect.Complex64, reflect.Complex128:
+		cx, cy := x.Complex(), y.Complex()
+		return s.floats(real(cx), real(cy)) && s.floats(imag(cx), imag(cy))
 
 	case reflect.Chan, reflect.UnsafePointer, reflect.Func:
 		return x.Pointer() == y.Pointer()
 
-	case reflect.Ptr, reflect.Interface:
-		return equal(x.Elem(), y.Elem(), seen)
+	case reflect.Ptr:
+		if x.IsNil() || y.IsNil() {
+			return x.IsNil() == y.IsNil()
+		}
+		if !s.equal(x.Elem(), y.Elem()) {
+			s.step("*")
+			return false
+		}
+		return true
+
+	case reflect.Interface:
+		if x.IsNil() || y.IsNil() {
+			return x.IsNil() == y.IsNil()
+		}
+		if !s.equal(x.Elem(), y.Elem()) {
+			s.step(".value")
+			return false
+		}
+		return true
 
 	case reflect.Array, reflect.Slice:
+		if x.Kind() == reflect.Slice && s.opts.StrictNil && x.IsNil() != y.IsNil() {
+			return false
+		}
 		if x.Len() != y.Len() {
 			return false
 		}
 		for i := 0; i < x.Len(); i++ {
-			if !equal(x.Index(i), y.Index(i), seen) {
+			if !s.equal(x.Index(i), y.Index(i)) {
+				s.step("[" + strconv.Itoa(i) + "]")
 				return false
 			}
 		}
 		return true
 
-		// .. struct and map cases omitted for brevity...
+	case reflect.Struct:
+		t := x.Type()
+		for i := 0; i < x.NumField(); i++ {
+			name := t.Field(i).Name
+			if s.ignore[name] || s.ignore[t.String()+"."+name] {
+				continue
+			}
+			if !s.equal(x.Field(i), y.Field(i)) {
+				s.step("." + name)
+				return false
+			}
+		}
+		return true
 
+	case reflect.Map:
+		if s.opts.StrictNil && x.IsNil() != y.IsNil() {
+			return false
+		}
+		if x.Len() != y.Len() {
+			return false
+		}
+		for _, k := range x.MapKeys() {
+			if !s.equal(x.MapIndex(k), y.MapIndex(k)) {
+				s.step("[" + format.Atom(k) + "]")
+				return false
+			}
+		}
+		return true
 	}
 	panic("unreachable")
 }
 
-// Equal reports whether x and y are deeply equal.
-// Impl: it must call `reflect.ValueOf` on its arguments.
-func Equal(x, y interface{}) bool {
-	seen := make(map[comparison]bool)
-	return equal(reflect.ValueOf(x), reflect.ValueOf(y), seen)
+// floats reports whether x and y are equal under the options.
+func (s *state) floats(x, y float64) bool {
+	if x == y {
+		return true
+	}
+	if math.IsNaN(x) || math.IsNaN(y) {
+		return s.opts.NaNEqual && math.IsNaN(x) && math.IsNaN(y)
+	}
+	if math.IsInf(x, 0) || math.IsInf(y, 0) {
+		return false
+	}
+	eps := s.opts.Epsilon
+	d := math.Abs(x - y)
+	return d <= eps || d <= eps*math.Max(math.Abs(x), math.Abs(y))
 }
 
-type comparison struct {
-	x, y unsafe.Pointer
-	t    reflect.Type
+// readable returns x and y in a form from which their values can be
+// obtained by Interface, even if they were reached through unexported
+// fields, if that is possible.
+func readable(x, y reflect.Value) (reflect.Value, reflect.Value, bool) {
+	if x.CanInterface() && y.CanInterface() {
+		return x, y, true
+	}
+	if !x.CanAddr() || !y.CanAddr() {
+		return x, y, false
+	}
+	x = reflect.NewAt(x.Type(), unsafe.Pointer(x.UnsafeAddr())).Elem()
+	y = reflect.NewAt(y.Type(), unsafe.Pointer(y.UnsafeAddr())).Elem()
+	return x, y, true
 }
 
 /*
@@ -92,4 +319,10 @@ fmt.Println(Equal(b, b)) // "true"
 fmt.Println(Equal(c, c)) // "true"
 fmt.Println(Equal(a, b)) // "false"
 fmt.Println(Equal(a, c)) // "false"
+
+// Options relax or tighten the comparison, and tell where values differ:
+opts := Options{Epsilon: 1e-9, IgnoreFields: []string{"ID"}}
+fmt.Println(opts.Equal([]float64{0.1 + 0.2}, []float64{0.3})) // "true"
+fmt.Println(Options{StrictNil: true}.Equal([]int(nil), []int{})) // "false"
+fmt.Println(Options{}.Difference(a, c)) // "(*x).value true"
 */
@@ -0,0 +1,362 @@
+package equal
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+type link struct {
+	value string
+	tail  *link
+}
+
+func TestEqual(t *testing.T) {
+	one, oneAgain, two := 1, 1, 2
+
+	// Circular linked lists a -> b -> a and c -> c.
+	a, b, c := &link{value: "a"}, &link{value: "b"}, &link{value: "c"}
+	a.tail, b.tail, c.tail = b, a, c
+
+	// Maps that contain themselves, by way of an interface.
+	m1 := map[string]interface{}{"n": 1}
+	m1["self"] = m1
+	m2 := map[string]interface{}{"n": 1}
+	m2["self"] = m2
+
+	type point struct{ X, Y float64 }
+	for _, test := range []struct {
+		x, y interface{}
+		want bool
+	}{
+		// basic values
+		{1, 1, true},
+		{1, 2, false},
+		{1, 1.0, false}, // different types
+		{int8(-1), int8(-1), true},
+		{uint(1), uint(2), false},
+		{2.5, 2.5, true},
+		{float32(1), float32(1.5), false},
+		{complex(1, 2), complex(1, 2), true},
+		{complex(1, 2), complex(1, 3), false},
+		{math.NaN(), math.NaN(), false},
+		{"foo", "foo", true},
+		{"foo", "bar", false},
+		{nil, nil, true},
+		{nil, 1, false},
+
+		// pointers, slices and maps
+		{&one, &one, true},
+		{&one, &oneAgain, true},
+		{&one, &two, false},
+		{(*int)(nil), &one, false},
+		{[]int{1, 2, 3}, []int{1, 2, 3}, true},
+		{[]int{1, 2, 3}, []int{1, 2, 4}, false},
+		{[]int{1, 2}, []int{1, 2, 3}, false},
+		{[]string(nil), []string{}, true},
+		{map[string]int(nil), map[string]int{}, true},
+		{map[string]int{"a": 1}, map[string]int{"a": 1}, true},
+		{map[string]int{"a": 1}, map[string]int{"b": 1}, false},
+		{map[string]int{"a": 1}, map[string]int{"a": 2}, false},
+		{[2]bool{true}, [2]bool{true}, true},
+
+		// structs and interfaces
+		{point{1, 2}, point{1, 2}, true},
+		{point{1, 2}, point{2, 1}, false},
+		{[]interface{}{1, "x"}, []interface{}{1, "x"}, true},
+		{[]interface{}{1}, []interface{}{int64(1)}, false},
+		{time.Second, time.Second, true},
+
+		// cycles
+		{a, a, true},
+		{b, b, true},
+		{c, c, true},
+		{a, b, false},
+		{a, c, false},
+		{m1, m2, true},
+	} {
+		if got := Equal(test.x, test.y); got != test.want {
+			t.Errorf("Equal(%#v, %#v) = %t", test.x, test.y, got)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	type record struct {
+		ID      int
+		Name    string
+		Score   float64
+		Created time.Time
+		Tags    []string
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	x := record{ID: 1, Name: "x", Score: 0.1 + 0.2, Created: now}
+	y := record{ID: 2, Name: "x", Score: 0.3, Created: now.In(time.FixedZone("CET", 3600)), Tags: []string{}}
+
+	for _, test := range []struct {
+		opts Options
+		x, y interface{}
+		want bool
+	}{
+		{Options{}, x, y, false},
+		{Options{
+			Epsilon:      1e-9,
+			IgnoreFields: []string{"ID"},
+			Comparators:  []Comparator{Compare(time.Time.Equal)},
+		}, x, y, true},
+		{Options{
+			Epsilon:      1e-9,
+			IgnoreFields: []string{"equal.record.ID"},
+			Comparators:  []Comparator{Compare(time.Time.Equal)},
+			StrictNil:    true,
+		}, x, y, false},
+		{Options{StrictNil: true}, []int(nil), []int{}, false},
+		{Options{StrictNil: true}, map[int]int(nil), map[int]int(nil), true},
+		{Options{NaNEqual: true}, math.NaN(), math.NaN(), true},
+		{Options{NaNEqual: true}, math.NaN(), 1.0, false},
+		{Options{Epsilon: 0.1}, complex(1, 1), complex(1.05, 0.95), true},
+		{Options{Epsilon: 0.1}, 100.0, 109.0, true}, // relatively
+		{Options{Epsilon: 0.1}, 0.01, 0.1, true},    // absolutely
+		{Options{Epsilon: 0.1}, 1.0, 1.2, false},
+		{Options{Epsilon: 1}, math.Inf(1), 1e308, false},
+		{Options{Comparators: []Comparator{Compare(strings.EqualFold)}},
+			[]string{"Go"}, []string{"GO"}, true},
+		// Comparators apply to unexported fields too.
+		{Options{Comparators: []Comparator{Compare(strings.EqualFold)}},
+			&link{value: "a"}, &link{value: "A"}, true},
+	} {
+		if got := test.opts.Equal(test.x, test.y); got != test.want {
+			t.Errorf("%+v.Equal(%#v, %#v) = %t", test.opts, test.x, test.y, got)
+		}
+	}
+}
+
+func TestDifference(t *testing.T) {
+	type item struct {
+		Name  string
+		Attrs map[string]interface{}
+	}
+	type order struct {
+		Items []*item
+	}
+	x := &order{Items: []*item{{Name: "a"}, {Name: "b", Attrs: map[string]interface{}{"size": 1}}}}
+	y := &order{Items: []*item{{Name: "a"}, {Name: "b", Attrs: map[string]interface{}{"size": 2}}}}
+	for _, test := range []struct {
+		x, y interface{}
+		want string
+	}{
+		{x, x, ""},
+		{x, y, `(*(*x).Items[1]).Attrs["size"].value`},
+		{1, 2, "x"},
+		{[]int{1, 2}, []int{1}, "x"},
+		{&link{"a", &link{value: "b"}}, &link{"a", nil}, "(*x).tail"},
+	} {
+		got, differ := Options{}.Difference(test.x, test.y)
+		if got != test.want || differ != (test.want != "") {
+			t.Errorf("Difference(%#v, %#v) = %q, %t, want %q", test.x, test.y, got, differ, test.want)
+		}
+	}
+}
+
+func TestFindCycles(t *testing.T) {
+	// Circular linked lists a -> b -> a and c -> c.
+	a, b, c := &link{value: "a"}, &link{value: "b"}, &link{value: "c"}
+	a.tail, b.tail, c.tail = b, a, c
+
+	m := map[string]interface{}{"n": 1}
+	m["self"] = m
+	s := []interface{}{nil, "x"}
+	s[0] = s
+
+	type tree struct {
+		Kids   []*tree
+		Parent *tree
+	}
+	root := &tree{}
+	root.Kids = []*tree{{Parent: root}, {Parent: root}}
+
+	for _, test := range []struct {
+		x    interface{}
+		want [][]string
+	}{
+		{nil, nil},
+		{1, nil},
+		{&link{value: "x", tail: &link{value: "y"}}, nil},
+		{c, [][]string{{"x", "(*x).tail"}}},
+		{a, [][]string{{"x", "(*x).tail", "(*(*x).tail).tail"}}},
+		{[]*link{a, c}, [][]string{
+			{"x[0]", "(*x[0]).tail", "(*(*x[0]).tail).tail"},
+			{"x[1]", "(*x[1]).tail"},
+		}},
+		{m, [][]string{{"x", `x["self"].value`}}},
+		{s, [][]string{{"x", "x[0].value"}}},
+		{s[:1], [][]string{{"x[0].value", "x[0].value[0].value"}}}, // x is shorter than s
+		{root, [][]string{
+			{"x", "(*x).Kids", "(*x).Kids[0]", "(*(*x).Kids[0]).Parent"},
+			{"x", "(*x).Kids", "(*x).Kids[1]", "(*(*x).Kids[1]).Parent"},
+		}},
+	} {
+		got := FindCycles(test.x)
+		if !(Options{StrictNil: true}).Equal(got, test.want) {
+			t.Errorf("FindCycles(%#v) = %q, want %q", test.x, got, test.want)
+		}
+		if got, want := IsCyclic(test.x), test.want != nil; got != want {
+			t.Errorf("IsCyclic(%#v) = %t, want %t", test.x, got, want)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	// Rings of one and two links, all valued "c", which are equal
+	// when unrolled.
+	c := &link{value: "c"}
+	c.tail = c
+	d, e := &link{value: "c"}, &link{value: "c"}
+	d.tail, e.tail = e, d
+
+	big := make(map[int]string)
+	for i := 0; i < 100; i++ {
+		big[i] = strings.Repeat("x", i)
+	}
+	bigAgain := make(map[int]string)
+	for i := 99; i >= 0; i-- {
+		bigAgain[i] = strings.Repeat("x", i)
+	}
+
+	for _, pair := range [][2]interface{}{
+		{nil, nil},
+		{1, 1},
+		{0.0, math.Copysign(0, -1)},
+		{[]int(nil), []int{}},
+		{map[string]int(nil), map[string]int{}},
+		{[]interface{}{1, "a", []int{2}}, []interface{}{1, "a", []int{2}}},
+		{big, bigAgain},
+		{c, d},
+		{struct{ P *link }{c}, struct{ P *link }{e}},
+	} {
+		x, y := pair[0], pair[1]
+		if !Equal(x, y) {
+			t.Fatalf("Equal(%#v, %#v) = false", x, y)
+		}
+		if Hash(x) != Hash(y) {
+			t.Errorf("Hash(%#v) = %x, Hash(%#v) = %x", x, Hash(x), y, Hash(y))
+		}
+	}
+
+	// Unequal values should hash differently, though they need not.
+	for _, pair := range [][2]interface{}{
+		{1, 2},
+		{1, int64(1)},
+		{"ab", "ba"},
+		{[]string{"a", "b"}, []string{"ab"}},
+		{[]interface{}{nil}, []interface{}{}},
+		{map[string]int{"a": 1, "b": 2}, map[string]int{"a": 2, "b": 1}},
+		{(*int)(nil), new(int)},
+	} {
+		x, y := pair[0], pair[1]
+		if Hash(x) == Hash(y) {
+			t.Errorf("Hash(%#v) = Hash(%#v) = %x", x, y, Hash(x))
+		}
+	}
+}
+
+func TestHashMap(t *testing.T) {
+	var m HashMap[[]string, int]
+	m.Set([]string{"a", "b"}, 1)
+	m.Set([]string{"a"}, 2)
+	m.Set([]string{"a", "b"}, 3) // replaces the first
+	m.Set(nil, 4)
+	m.Set([]string{}, 5) // replaces nil
+	if m.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", m.Len())
+	}
+	for _, test := range []struct {
+		key  []string
+		want int
+		ok   bool
+	}{
+		{[]string{"a", "b"}, 3, true},
+		{[]string{"a"}, 2, true},
+		{nil, 5, true},
+		{[]string{"b"}, 0, false},
+	} {
+		if got, ok := m.Get(test.key); got != test.want || ok != test.ok {
+			t.Errorf("Get(%q) = %d, %t, want %d, %t", test.key, got, ok, test.want, test.ok)
+		}
+	}
+
+	m.Delete([]string{"a"})
+	m.Delete([]string{"z"})
+	sum := 0
+	m.Range(func(key []string, value int) bool {
+		sum += value
+		return true
+	})
+	if m.Len() != 2 || sum != 8 {
+		t.Errorf("after Delete, Len() = %d and values sum to %d, want 2 and 8", m.Len(), sum)
+	}
+}
+
+// A record is a typical value to hash: a struct with a slice and a map.
+type record struct {
+	ID    int
+	Name  string
+	Tags  []string
+	Attrs map[string]float64
+	Next  *record
+}
+
+func newRecord(i int) *record {
+	return &record{
+		ID:    i,
+		Name:  fmt.Sprintf("record %d", i),
+		Tags:  []string{"a", "b", "c"},
+		Attrs: map[string]float64{"x": float64(i), "y": 0.5},
+		Next:  &record{ID: i + 1},
+	}
+}
+
+func BenchmarkHash(b *testing.B) {
+	r := newRecord(1)
+	for i := 0; i < b.N; i++ {
+		Hash(r)
+	}
+}
+
+func BenchmarkEqual(b *testing.B) {
+	x, y := newRecord(1), newRecord(1)
+	for i := 0; i < b.N; i++ {
+		Equal(x, y)
+	}
+}
+
+func BenchmarkHashMap(b *testing.B) {
+	const n = 1000
+	keys := make([]*record, n)
+	for i := range keys {
+		keys[i] = newRecord(i)
+	}
+	b.Run("Set", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var m HashMap[*record, int]
+			for j, key := range keys {
+				m.Set(key, j)
+			}
+		}
+		b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*n), "ns/key")
+	})
+	b.Run("Get", func(b *testing.B) {
+		var m HashMap[*record, int]
+		for j, key := range keys {
+			m.Set(key, j)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			m.Get(keys[i%n])
+		}
+	})
+}
+
+// $ go test -run=NONE -bench=. $GOPATH/13_lowlevel/equal
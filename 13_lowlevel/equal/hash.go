@@ -0,0 +1,232 @@
+package equal
+
+import (
+	"hash"
+	"hash/fnv"
+	"math"
+	"reflect"
+	"unsafe"
+)
+
+// maxHops is the number of pointers, maps and slices that Hash
+// follows in succession.
+const maxHops = 16
+
+// Hash returns a hash of x consistent with Equal: values that are
+// deeply equal hash the same. So that cyclic values, which Equal
+// compares as if unrolled, do too, Hash follows only maxHops
+// pointers, maps and slices in succession; beyond that, only their
+// lengths and nilness count. Values must not change while being
+// hashed, nor between hashing and use of the hash.
+func Hash(x interface{}) uint64 {
+	h := &hasher{memo: make(map[hashKey]uint64)}
+	w := fnv.New64a()
+	v := reflect.ValueOf(x)
+	if v.IsValid() {
+		w.Write([]byte(v.Type().String()))
+	}
+	h.write(w, v, maxHops)
+	return w.Sum64()
+}
+
+// A hasher holds the state of a single call to Hash.
+type hasher struct {
+	memo map[hashKey]uint64 // hashes of references, for shared ones
+}
+
+// A hashKey identifies the hash of the referent of a pointer,
+// map or slice when followed with the given hops remaining.
+type hashKey struct {
+	r    reference
+	hops int
+}
+
+// write writes v to w, following up to hops references.
+func (h *hasher) write(w hash.Hash64, v reflect.Value, hops int) {
+	switch v.Kind() {
+	case reflect.Invalid:
+		put(w, 0)
+	case reflect.Bool:
+		if v.Bool() {
+			put(w, 1)
+		} else {
+			put(w, 0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		put(w, uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		put(w, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		putFloat(w, v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		putFloat(w, real(c))
+		putFloat(w, imag(c))
+	case reflect.String:
+		put(w, uint64(v.Len()))
+		w.Write([]byte(v.String()))
+	case reflect.Chan, reflect.UnsafePointer, reflect.Func:
+		put(w, uint64(v.Pointer()))
+
+	case reflect.Interface:
+		if v.IsNil() {
+			put(w, 0)
+			return
+		}
+		put(w, 1)
+		w.Write([]byte(v.Elem().Type().String())) // values of different types differ
+		h.write(w, v.Elem(), hops)
+
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			h.write(w, v.Index(i), hops)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			h.write(w, v.Field(i), hops)
+		}
+
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		// As for Equal, nil slices and maps are empty ones.
+		if v.IsNil() || v.Kind() != reflect.Ptr && v.Len() == 0 {
+			put(w, 0)
+			return
+		}
+		if v.Kind() == reflect.Ptr {
+			put(w, 1)
+		} else {
+			put(w, uint64(v.Len()))
+		}
+		if hops > 0 {
+			put(w, h.referent(v, hops-1))
+		}
+	}
+}
+
+// referent returns the hash of the referent of v, a non-nil pointer
+// or non-empty map or slice, following up to hops more references.
+func (h *hasher) referent(v reflect.Value, hops int) uint64 {
+	key := hashKey{reference{unsafe.Pointer(v.Pointer()), v.Type(), 0}, hops}
+	if v.Kind() == reflect.Slice {
+		key.r.len = v.Len()
+	}
+	if sum, ok := h.memo[key]; ok {
+		return sum
+	}
+
+	w := fnv.New64a()
+	switch v.Kind() {
+	case reflect.Ptr:
+		h.write(w, v.Elem(), hops)
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			h.write(w, v.Index(i), hops)
+		}
+	case reflect.Map:
+		// Entries are combined in an order-independent way.
+		var sum uint64
+		for _, k := range v.MapKeys() {
+			e := fnv.New64a()
+			h.write(e, k, hops)
+			h.write(e, v.MapIndex(k), hops)
+			sum += e.Sum64()
+		}
+		put(w, sum)
+	}
+	h.memo[key] = w.Sum64()
+	return h.memo[key]
+}
+
+// put writes x to w in little-endian order.
+func put(w hash.Hash64, x uint64) {
+	var b [8]byte
+	for i := range b {
+		b[i] = byte(x >> (8 * i))
+	}
+	w.Write(b[:])
+}
+
+// putFloat writes f to w, with -0 written as +0, to which it is equal.
+func putFloat(w hash.Hash64, f float64) {
+	if f == 0 {
+		f = 0
+	}
+	put(w, math.Float64bits(f))
+}
+
+// A HashMap is a map whose keys are compared by Equal, so that
+// deeply equal keys, such as slices with the same elements, denote
+// the same entry. Keys must not change while in the map. The zero
+// HashMap is empty and ready to use.
+type HashMap[K any, V any] struct {
+	buckets map[uint64][]entry[K, V]
+	len     int
+}
+
+type entry[K any, V any] struct {
+	key   K
+	value V
+}
+
+// Len returns the number of entries in m.
+func (m *HashMap[K, V]) Len() int { return m.len }
+
+// Get returns the value of the entry whose key is deeply equal to
+// key, and whether there is one.
+func (m *HashMap[K, V]) Get(key K) (V, bool) {
+	for _, e := range m.buckets[Hash(key)] {
+		if Equal(e.key, key) {
+			return e.value, true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// Set sets the value of the entry whose key is deeply equal to key,
+// adding an entry for key if there is none.
+func (m *HashMap[K, V]) Set(key K, value V) {
+	h := Hash(key)
+	bucket := m.buckets[h]
+	for i := range bucket {
+		if Equal(bucket[i].key, key) {
+			bucket[i].value = value
+			return
+		}
+	}
+	if m.buckets == nil {
+		m.buckets = make(map[uint64][]entry[K, V])
+	}
+	m.buckets[h] = append(bucket, entry[K, V]{key, value})
+	m.len++
+}
+
+// Delete removes the entry whose key is deeply equal to key, if any.
+func (m *HashMap[K, V]) Delete(key K) {
+	h := Hash(key)
+	bucket := m.buckets[h]
+	for i := range bucket {
+		if Equal(bucket[i].key, key) {
+			bucket = append(bucket[:i], bucket[i+1:]...)
+			if len(bucket) == 0 {
+				delete(m.buckets, h)
+			} else {
+				m.buckets[h] = bucket
+			}
+			m.len--
+			return
+		}
+	}
+}
+
+// Range calls f for each entry of m, in no particular order,
+// until f returns false.
+func (m *HashMap[K, V]) Range(f func(key K, value V) bool) {
+	for _, bucket := range m.buckets {
+		for _, e := range bucket {
+			if !f(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package memo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DiskStore is a Store that keeps each entry in its own file
+// beneath a directory, so that memoized results survive process
+// restarts and can be shared by several processes at once.
+//
+// Entries are content-addressed by the SHA-256 of their key:
+// the entry for a key whose hash is "ab12..." lives in dir/ab/ab12...
+// Each file is a gob-encoded record holding the key, the value
+// and its creation and expiry times. Values are stored as
+// interface{}, so their concrete types must be registered with
+// gob.Register; []byte, the result of httpGetBody, already is.
+//
+// Writers take an exclusive flock(2) on a per-entry lock file and
+// readers a shared one, and every write goes to a temporary file
+// that is renamed into place, so no process sees a partial entry.
+type DiskStore struct {
+	dir string
+	ttl time.Duration
+}
+
+// record is the on-disk representation of an entry.
+type record struct {
+	Key     string
+	Value   interface{}
+	Created time.Time
+	Expires time.Time // zero if the entry never expires
+}
+
+const (
+	lockSuffix = ".lock"
+	tempSuffix = ".tmp"
+)
+
+// OpenDiskStore returns a DiskStore rooted at dir, creating the
+// directory if necessary. Entries older than ttl are treated as
+// missing; a ttl of zero means entries never expire.
+func OpenDiskStore(dir string, ttl time.Duration) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DiskStore{dir: dir, ttl: ttl}, nil
+}
+
+// path returns the name of the file holding the entry for key.
+func (s *DiskStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(s.dir, name[:2], name)
+}
+
+// Load returns the entry saved for key if it exists and has not expired.
+func (s *DiskStore) Load(key string) (Stored, bool) {
+	rec, err := s.read(s.path(key))
+	if err != nil || rec.Key != key || rec.expired(time.Now()) {
+		return Stored{}, false
+	}
+	return rec.stored(), true
+}
+
+// Save writes value as the entry for key, replacing any previous one,
+// and returns when it expires.
+func (s *DiskStore) Save(key string, value interface{}) (time.Time, error) {
+	now := time.Now()
+	rec := record{Key: key, Value: value, Created: now}
+	if s.ttl > 0 {
+		rec.Expires = now.Add(s.ttl)
+	}
+	if err := s.write(&rec); err != nil {
+		return time.Time{}, err
+	}
+	return rec.Expires, nil
+}
+
+// write encodes rec into the file for its key under an exclusive lock.
+func (s *DiskStore) write(rec *record) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(rec); err != nil {
+		return err
+	}
+
+	name := s.path(rec.Key)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	unlock, err := lock(name, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+"-*"+tempSuffix)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Walk calls fn for every unexpired entry in the store.
+// Entries that cannot be read or decoded, perhaps because they
+// were written by an incompatible version of the program, are
+// skipped rather than reported.
+func (s *DiskStore) Walk(fn func(key string, v Stored)) error {
+	now := time.Now()
+	return filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, lockSuffix) || strings.HasSuffix(path, tempSuffix) {
+			return nil
+		}
+		rec, err := s.read(path)
+		if err != nil || rec.expired(now) {
+			return nil
+		}
+		fn(rec.Key, rec.stored())
+		return nil
+	})
+}
+
+// read decodes the record in the named file under a shared lock.
+func (s *DiskStore) read(name string) (*record, error) {
+	if _, err := os.Stat(name); err != nil {
+		return nil, err // don't create lock files for missing entries
+	}
+	unlock, err := lock(name, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var rec record
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (r *record) expired(now time.Time) bool {
+	return !r.Expires.IsZero() && now.After(r.Expires)
+}
+
+func (r *record) stored() Stored {
+	return Stored{Value: r.Value, Created: r.Created, Expires: r.Expires}
+}
+
+// lock acquires a lock on the lock file associated with name and
+// returns a function that releases it. The lock file is separate
+// from the entry itself because Save replaces the entry by rename,
+// and a lock held on the old file would not exclude the new one.
+func lock(name string, exclusive bool) (unlock func(), err error) {
+	f, err := os.OpenFile(name+lockSuffix, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := flock(f, exclusive); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("memo: locking %s: %v", f.Name(), err)
+	}
+	return func() {
+		funlock(f)
+		f.Close()
+	}, nil
+}
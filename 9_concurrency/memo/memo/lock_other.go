@@ -0,0 +1,12 @@
+//go:build !unix
+
+package memo
+
+import "os"
+
+// On platforms without flock(2), DiskStore relies on atomic renames
+// alone: readers never see a partial entry, but concurrent writers
+// of the same key are not serialized.
+func flock(f *os.File, exclusive bool) error { return nil }
+
+func funlock(f *os.File) error { return nil }
@@ -0,0 +1,22 @@
+//go:build unix
+
+package memo
+
+import (
+	"os"
+	"syscall"
+)
+
+// flock takes an advisory lock on f, shared unless exclusive is set,
+// blocking until it is available.
+func flock(f *os.File, exclusive bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	return syscall.Flock(int(f.Fd()), how)
+}
+
+func funlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
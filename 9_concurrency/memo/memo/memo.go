@@ -3,9 +3,25 @@
 // with designs based on a single lock for the entire cache.
 package memo
 
+import "time"
+
 // Func is the type of the function to memoize
 type Func func(key string) (interface{}, error)
 
+// Cache is the interface shared by the designs in this package:
+// the monitor-goroutine Memo, the lock-based MutexMemo and the
+// ShardedMemo. Clients must call Close when done with a Cache.
+type Cache interface {
+	Get(key string) (interface{}, error)
+	Close()
+}
+
+var (
+	_ Cache = (*Memo)(nil)
+	_ Cache = (*MutexMemo)(nil)
+	_ Cache = (*ShardedMemo)(nil)
+)
+
 // result of a memoized function call
 type result struct {
 	value interface{}
@@ -23,12 +39,61 @@ type request struct {
 // The channel only carries a single value.
 type Memo struct {
 	requests chan request
+	store    Store // optional second-level cache
+
+	// Refresh-ahead: see WithSoftExpiry.
+	soft           time.Duration
+	onRefreshError func(key string, err error)
+	refreshed      chan refresh
+	done           chan struct{} // closed when the monitor exits
+}
+
+// An Option configures a Memo created by New.
+type Option func(*Memo)
+
+// WithStore makes s a second-level cache behind the in-memory one.
+// Completed results are written to s, lookups that miss in memory
+// consult s before calling f, and the in-memory cache is warmed
+// with the contents of s when the Memo starts. Results read from
+// or saved to s are dropped from memory when their entries in s expire.
+func WithStore(s Store) Option {
+	return func(m *Memo) { m.store = s }
+}
+
+// WithSoftExpiry makes entries stale once they are older than d.
+// A Get for a stale entry does not block: it returns the cached
+// result immediately, and the monitor goroutine starts a single
+// background call of f for that key, however many Gets arrive
+// while it runs. When the call succeeds its result replaces the
+// stale one; when it fails the stale result is kept, and the next
+// Get for the key tries again.
+func WithSoftExpiry(d time.Duration) Option {
+	return func(m *Memo) { m.soft = d }
+}
+
+// OnRefreshError registers fn to observe failed background refreshes.
+// It is called from the refreshing goroutine, not the monitor,
+// so a slow fn does not hold up other Gets.
+func OnRefreshError(fn func(key string, err error)) Option {
+	return func(m *Memo) { m.onRefreshError = fn }
 }
 
 // New returns a memoization of f. Clients must subsequently call Close.
-func New(f Func) *Memo {
-	m := &Memo{requests: make(chan request)}
-	go m.server(f)
+func New(f Func, opts ...Option) *Memo {
+	m := &Memo{
+		requests:  make(chan request),
+		refreshed: make(chan refresh),
+		done:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	load, fetch := plain(f), plain(f)
+	if m.store != nil {
+		fetch = saving(f, m.store)
+		load = loading(fetch, m.store)
+	}
+	go m.server(load, fetch)
 	return m
 }
 
@@ -54,17 +119,80 @@ func (m *Memo) Close() {
 // channel is closed by the Close method.
 // For each request, it consults the cache, creating and
 // inserting a new entry if none was found.
-func (m *Memo) server(f Func) {
+// The first call for a key uses load, which may be satisfied by
+// the store; refreshes use fetch, which always calls f.
+// An entry past its expiry time is treated as missing.
+//
+// The monitor also receives the outcome of background refreshes,
+// since it alone may update the cache.
+func (m *Memo) server(load, fetch source) {
+	defer close(m.done)
 	cache := make(map[string]*entry)
-	for req := range m.requests {
-		e := cache[req.key]
-		if e == nil {
-			// This is the first request for this key.
-			e = &entry{ready: make(chan struct{})}
-			cache[req.key] = e
-			go e.call(f, req.key) // call f(key)
+	if m.store != nil {
+		warm(cache, m.store)
+	}
+	for {
+		select {
+		case req, ok := <-m.requests:
+			if !ok {
+				return
+			}
+			e := cache[req.key]
+			if e == nil || e.expired(time.Now()) {
+				// This is the first request for this key,
+				// or the first since its entry expired.
+				e = &entry{ready: make(chan struct{})}
+				cache[req.key] = e
+				go e.call(load, req.key) // call f(key)
+			} else if m.stale(e) {
+				// Serve the stale result, and refresh it once.
+				e.refreshing = true
+				go m.refresh(fetch, req.key, e)
+			}
+			go e.deliver(req.response)
+
+		case r := <-m.refreshed:
+			if r.fresh.res.err != nil {
+				r.stale.refreshing = false // keep serving the stale result
+			} else if cache[r.key] == r.stale {
+				cache[r.key] = r.fresh
+			}
 		}
-		go e.deliver(req.response)
+	}
+}
+
+// stale reports whether e is ready, older than the soft expiry,
+// and not already being refreshed. Only the monitor may call it.
+func (m *Memo) stale(e *entry) bool {
+	if m.soft <= 0 || e.refreshing {
+		return false
+	}
+	select {
+	case <-e.ready:
+		return time.Since(e.completed) > m.soft
+	default:
+		return false // still being computed
+	}
+}
+
+// A refresh is the outcome of recomputing a stale entry.
+type refresh struct {
+	key          string
+	stale, fresh *entry
+}
+
+// refresh computes a fresh entry for key in the background and
+// hands it to the monitor goroutine, unless the Memo was closed
+// in the meantime.
+func (m *Memo) refresh(f source, key string, stale *entry) {
+	fresh := &entry{ready: make(chan struct{})}
+	fresh.call(f, key)
+	if err := fresh.res.err; err != nil && m.onRefreshError != nil {
+		m.onRefreshError(key, err)
+	}
+	select {
+	case m.refreshed <- refresh{key, stale, fresh}:
+	case <-m.done:
 	}
 }
 
@@ -74,8 +202,13 @@ func (m *Memo) server(f Func) {
 // be closed, to broadcast to any other gourtines that it is
 // now safe for them to read the result from the entry.
 type entry struct {
-	res   result
-	ready chan struct{} // closed when res is ready
+	res       result
+	ready     chan struct{} // closed when res is ready
+	completed time.Time     // when res was computed
+	expires   time.Time     // when res expires; zero if never
+	// refreshing is set while a background refresh of this entry
+	// is in flight; it is accessed only by the monitor goroutine.
+	refreshing bool
 }
 
 // NOTE: the call and deliver methods must be called in their own goroutines
@@ -85,13 +218,28 @@ type entry struct {
 // for calling the function f on that key, storing the
 // result in the entry, and broadcasting the readiness of the entry
 // by closing the ready channel.
-func (e *entry) call(f Func, key string) {
+func (e *entry) call(f source, key string) {
 	// Evaluate the function.
-	e.res.value, e.res.err = f(key)
+	v, err := f(key)
+	e.res = result{v.Value, err}
+	e.completed, e.expires = v.Created, v.Expires
+	if e.completed.IsZero() {
+		e.completed = time.Now()
+	}
 	// Broadcast the ready condition.
 	close(e.ready)
 }
 
+// expired reports whether e is ready and its result has expired.
+func (e *entry) expired(now time.Time) bool {
+	select {
+	case <-e.ready:
+		return !e.expires.IsZero() && now.After(e.expires)
+	default:
+		return false // still being computed
+	}
+}
+
 // A subsequent request for the same key finds the existing
 // entry in the map, waits for the result to become ready, and sends
 // the result through the response channel to the client goroutine
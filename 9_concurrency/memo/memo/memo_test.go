@@ -1,23 +1,271 @@
 package memo_test
 
 import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"gopl.io/ch9/memo"
 	"gopl.io/ch9/memotest"
 )
 
 var httpGetBody = memotest.HTTPGetBody
 
+// latency is the delay of every response from the test server;
+// it makes concurrent requests for the same page overlap.
+const latency = 20 * time.Millisecond
+
 func Test(t *testing.T) {
+	s := memotest.NewServer(latency)
+	defer s.Close()
 	m := memo.New(httpGetBody)
 	defer m.Close()
-	memotest.Sequential(t, m)
+	memotest.Sequential(t, m, s)
 }
 
 func TestConcurrent(t *testing.T) {
+	s := memotest.NewServer(latency)
+	defer s.Close()
+	s.Fail("/play", http.StatusServiceUnavailable)
 	m := memo.New(httpGetBody)
 	defer m.Close()
-	memotest.Concurrent(t, m)
+	memotest.Concurrent(t, m, s)
+}
+
+func TestMutexConcurrent(t *testing.T) {
+	s := memotest.NewServer(latency)
+	defer s.Close()
+	s.Fail("/play", http.StatusServiceUnavailable)
+	m := memo.NewMutex(httpGetBody)
+	defer m.Close()
+	memotest.Concurrent(t, m, s)
+}
+
+func TestShardedConcurrent(t *testing.T) {
+	s := memotest.NewServer(latency)
+	defer s.Close()
+	s.Fail("/play", http.StatusServiceUnavailable)
+	m := memo.NewSharded(httpGetBody, 4)
+	defer m.Close()
+	memotest.Concurrent(t, m, s)
 }
 
 // $ go test -run=TestConcurrent -race -v $GOPATH/9_concurrency/memo/memo
+
+// TestDiskStore checks that a second Memo, standing in for a
+// restarted process, is served from disk without calling f.
+func TestDiskStore(t *testing.T) {
+	dir := t.TempDir()
+	var calls int32
+	f := func(key string) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return []byte("value of " + key), nil
+	}
+
+	for run := 0; run < 2; run++ {
+		s, err := memo.OpenDiskStore(dir, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := memo.New(f, memo.WithStore(s))
+		for i := 0; i < 3; i++ {
+			key := fmt.Sprintf("k%d", i)
+			v, err := m.Get(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := string(v.([]byte)), "value of "+key; got != want {
+				t.Errorf("run %d: Get(%q) = %q, want %q", run, key, got, want)
+			}
+		}
+		m.Close()
+	}
+	if calls != 3 {
+		t.Errorf("f called %d times, want 3", calls)
+	}
+
+	// An expired entry is recomputed.
+	s, err := memo.OpenDiskStore(dir, time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Save("stale", []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, ok := s.Load("stale"); ok {
+		t.Errorf("Load returned an expired entry")
+	}
+}
+
+// TestDiskStoreExpiry checks that entries computed, loaded or warmed
+// from a store are dropped from memory when they expire on disk.
+func TestDiskStoreExpiry(t *testing.T) {
+	const ttl = 100 * time.Millisecond
+	dir := t.TempDir()
+	var calls int32
+	f := func(key string) (interface{}, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}
+	s, err := memo.OpenDiskStore(dir, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(m *memo.Memo) {
+		if _, err := m.Get("k"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(what string, want int32) {
+		if n := atomic.LoadInt32(&calls); n != want {
+			t.Errorf("%s: f called %d times, want %d", what, n, want)
+		}
+	}
+
+	m := memo.New(f, memo.WithStore(s))
+	get(m)
+	get(m)
+	check("computed", 1)
+	time.Sleep(2 * ttl)
+	get(m)
+	check("computed and expired", 2)
+	m.Close()
+
+	m = memo.New(f, memo.WithStore(s)) // warmed with the second result
+	get(m)
+	check("warmed", 2)
+	time.Sleep(2 * ttl)
+	get(m)
+	check("warmed and expired", 3)
+	m.Close()
+}
+
+// TestStoreSoftExpiry checks that an entry warmed from disk is as
+// old as when it was saved, so a restart does not make it fresh.
+func TestStoreSoftExpiry(t *testing.T) {
+	const soft = 10 * time.Millisecond
+	s, err := memo.OpenDiskStore(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Save("k", "saved"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * soft)
+
+	refreshed := make(chan string, 1)
+	f := func(key string) (interface{}, error) {
+		refreshed <- key
+		return "fresh", nil
+	}
+	m := memo.New(f, memo.WithStore(s), memo.WithSoftExpiry(soft))
+	defer m.Close()
+	if v, err := m.Get("k"); err != nil || v != "saved" {
+		t.Fatalf("Get = %v, %v, want saved", v, err)
+	}
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("stale warmed entry was not refreshed")
+	}
+}
+
+// TestSoftExpiry checks that a stale entry is served without
+// blocking while a single background call refreshes it, and that
+// a failed refresh is reported and leaves the stale value in place.
+func TestSoftExpiry(t *testing.T) {
+	const soft = 10 * time.Millisecond
+	var calls int32
+	release := make(chan struct{})
+	f := func(key string) (interface{}, error) {
+		n := atomic.AddInt32(&calls, 1)
+		if n > 1 {
+			<-release // hold refreshes until the test lets them go
+		}
+		if n == 3 {
+			return nil, fmt.Errorf("refresh %d failed", n)
+		}
+		return n, nil
+	}
+	refreshErrs := make(chan error, 1)
+	m := memo.New(f, memo.WithSoftExpiry(soft),
+		memo.OnRefreshError(func(key string, err error) { refreshErrs <- err }))
+	defer m.Close()
+
+	get := func() int32 {
+		v, err := m.Get("k")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.(int32)
+	}
+	// waitFor polls until Get returns want or gives up.
+	waitFor := func(want int32) {
+		deadline := time.Now().Add(time.Second)
+		for get() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("Get never returned %d", want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if got := get(); got != 1 {
+		t.Fatalf("first Get = %d, want 1", got)
+	}
+	time.Sleep(2 * soft)
+	for i := 0; i < 5; i++ {
+		if got := get(); got != 1 { // stale, but immediate
+			t.Fatalf("stale Get = %d, want 1", got)
+		}
+	}
+	close(release)
+	waitFor(2)
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("f called %d times, want 2 (one refresh)", n)
+	}
+
+	time.Sleep(2 * soft)
+	get() // triggers refresh 3, which fails
+	select {
+	case err := <-refreshErrs:
+		t.Logf("refresh error: %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("refresh error hook not called")
+	}
+	waitFor(4) // the failed refresh kept 2; the next one succeeds
+}
+
+// Each design is benchmarked under the same two workloads.
+var designs = []struct {
+	name string
+	new  func(memo.Func) memo.Cache
+}{
+	{"Monitor", func(f memo.Func) memo.Cache { return memo.New(f) }},
+	{"Mutex", func(f memo.Func) memo.Cache { return memo.NewMutex(f) }},
+	{"Sharded", func(f memo.Func) memo.Cache { return memo.NewSharded(f, 0) }},
+}
+
+func BenchmarkHighCardinality(b *testing.B) {
+	for _, d := range designs {
+		b.Run(d.name, func(b *testing.B) {
+			m := d.new(memotest.Expensive)
+			defer m.Close()
+			memotest.HighCardinality(b, m)
+		})
+	}
+}
+
+func BenchmarkHotKeys(b *testing.B) {
+	for _, d := range designs {
+		b.Run(d.name, func(b *testing.B) {
+			m := d.new(memotest.Expensive)
+			defer m.Close()
+			memotest.HotKeys(b, m)
+		})
+	}
+}
+
+// $ go test -run=NONE -bench=. -cpu=1,8 $GOPATH/9_concurrency/memo/memo
@@ -0,0 +1,47 @@
+package memo
+
+import "sync"
+
+// MutexMemo is the lock-based alternative to Memo.
+// Instead of confining the cache to a monitor goroutine,
+// the map is guarded by a mutex. Duplicate suppression comes
+// from the same entry type: the first Get for a key inserts an
+// entry and calls f, while later Gets for that key wait on the
+// entry's ready channel.
+type MutexMemo struct {
+	f     Func
+	mu    sync.Mutex // guards cache
+	cache map[string]*entry
+}
+
+// NewMutex returns a lock-based memoization of f.
+func NewMutex(f Func) *MutexMemo {
+	return &MutexMemo{f: f, cache: make(map[string]*entry)}
+}
+
+// Get is concurrency-safe. The lock is held only while the
+// map is consulted, never while f runs, so slow calls for one
+// key do not block Gets for other keys.
+func (m *MutexMemo) Get(key string) (interface{}, error) {
+	m.mu.Lock()
+	e := m.cache[key]
+	if e == nil {
+		// This is the first request for this key.
+		// This goroutine becomes responsible for computing
+		// the value and broadcasting the ready condition.
+		e = &entry{ready: make(chan struct{})}
+		m.cache[key] = e
+		m.mu.Unlock()
+
+		e.call(plain(m.f), key)
+	} else {
+		// This is a repeat request for this key.
+		m.mu.Unlock()
+
+		<-e.ready // wait for ready condition
+	}
+	return e.res.value, e.res.err
+}
+
+// Close is a no-op; it exists so that MutexMemo satisfies Cache.
+func (m *MutexMemo) Close() {}
@@ -0,0 +1,48 @@
+package memo
+
+import (
+	"hash/fnv"
+	"runtime"
+)
+
+// ShardedMemo spreads keys over several independent Memos.
+// A single monitor goroutine serializes every Get, which becomes
+// the bottleneck once many goroutines hit the cache at once.
+// Hashing each key to one of n shards keeps all requests for a
+// given key on the same monitor, so duplicate suppression still
+// holds, while requests for different keys proceed in parallel.
+type ShardedMemo struct {
+	shards []*Memo
+}
+
+// NewSharded returns a memoization of f split over n shards.
+// If n <= 0, one shard per available CPU is used.
+// Clients must subsequently call Close.
+func NewSharded(f Func, n int) *ShardedMemo {
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	m := &ShardedMemo{shards: make([]*Memo, n)}
+	for i := range m.shards {
+		m.shards[i] = New(f)
+	}
+	return m
+}
+
+// Get forwards the request to the shard that owns key.
+func (m *ShardedMemo) Get(key string) (interface{}, error) {
+	return m.shard(key).Get(key)
+}
+
+// Close closes every shard.
+func (m *ShardedMemo) Close() {
+	for _, s := range m.shards {
+		s.Close()
+	}
+}
+
+func (m *ShardedMemo) shard(key string) *Memo {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return m.shards[h.Sum32()%uint32(len(m.shards))]
+}
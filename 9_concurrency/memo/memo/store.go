@@ -0,0 +1,86 @@
+package memo
+
+import "time"
+
+// A Store is a second-level cache that outlives the Memo using it,
+// for instance one kept on disk across process restarts.
+// Implementations must be safe for concurrent use, since Load and
+// Save are called from the goroutines evaluating the Func.
+type Store interface {
+	// Load returns the entry saved for key, if any.
+	Load(key string) (v Stored, ok bool)
+	// Save records value as the result for key and returns
+	// when the saved entry expires.
+	Save(key string, value interface{}) (expires time.Time, err error)
+	// Walk calls fn for every entry currently in the store.
+	Walk(fn func(key string, v Stored)) error
+}
+
+// Stored is an entry held by a Store. A Memo drops it from memory
+// once it expires, as the Store itself does, and judges its age for
+// WithSoftExpiry from when it was created, not when it was read.
+type Stored struct {
+	Value   interface{}
+	Created time.Time // zero if unknown
+	Expires time.Time // zero if the entry never expires
+}
+
+// A source produces the result for a key, like a Func, together
+// with when it was created and when it expires, if known.
+type source func(key string) (Stored, error)
+
+// plain makes f a source whose results never expire.
+func plain(f Func) source {
+	return func(key string) (Stored, error) {
+		value, err := f(key)
+		return Stored{Value: value}, err
+	}
+}
+
+// loading wraps f so that s is consulted before f is called.
+func loading(f source, s Store) source {
+	return func(key string) (Stored, error) {
+		if v, ok := s.Load(key); ok {
+			return v, nil
+		}
+		return f(key)
+	}
+}
+
+// saving wraps f so that successful results are written to s,
+// and expire when their saved copies do.
+// Errors are never saved, so a failed call is retried by the
+// next process rather than remembered forever.
+func saving(f Func, s Store) source {
+	return func(key string) (Stored, error) {
+		value, err := f(key)
+		if err != nil {
+			return Stored{Value: value}, err
+		}
+		// The store is only a cache: failing to save costs
+		// a recomputation later, not a wrong answer now.
+		expires, _ := s.Save(key, value)
+		return Stored{Value: value, Expires: expires}, nil
+	}
+}
+
+// warm fills cache with ready entries for everything in s.
+// It runs in the monitor goroutine before the first request
+// is served, so there is no need to synchronize on cache.
+func warm(cache map[string]*entry, s Store) {
+	// A failed walk leaves a partially warmed cache,
+	// and the missing keys are loaded on demand instead.
+	_ = s.Walk(func(key string, v Stored) {
+		if v.Created.IsZero() {
+			v.Created = time.Now()
+		}
+		e := &entry{
+			res:       result{value: v.Value},
+			ready:     make(chan struct{}),
+			completed: v.Created,
+			expires:   v.Expires,
+		}
+		close(e.ready)
+		cache[key] = e
+	})
+}
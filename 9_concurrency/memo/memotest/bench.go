@@ -0,0 +1,85 @@
+package memotest
+
+import (
+	"crypto/sha256"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Expensive is a CPU-bound stand-in for httpGetBody.
+// The benchmarks use it instead of the network so that
+// they measure the cache rather than the remote servers.
+func Expensive(key string) (interface{}, error) {
+	sum := sha256.Sum256([]byte(key))
+	for i := 0; i < 100; i++ {
+		sum = sha256.Sum256(sum[:])
+	}
+	return sum[:], nil
+}
+
+// HighCardinality benchmarks m with keys drawn uniformly from a
+// large key space, so most Gets are misses that call the function.
+func HighCardinality(b *testing.B, m M) {
+	const keys = 1 << 24
+	bench(b, m, func(r *rand.Rand) func() string {
+		return func() string { return strconv.Itoa(r.Intn(keys)) }
+	})
+}
+
+// HotKeys benchmarks m with keys drawn from a Zipf distribution,
+// so a handful of keys receive most of the traffic and most Gets
+// are hits contending for the same entries.
+func HotKeys(b *testing.B, m M) {
+	const keys = 1 << 16
+	bench(b, m, func(r *rand.Rand) func() string {
+		z := rand.NewZipf(r, 1.1, 1, keys-1)
+		return func() string { return strconv.FormatUint(z.Uint64(), 10) }
+	})
+}
+
+// bench calls m.Get from GOMAXPROCS goroutines, each drawing keys
+// from its own generator. Besides the usual ns/op, which reflects
+// throughput, it reports the median and tail latency of a Get.
+func bench(b *testing.B, m M, keygen func(*rand.Rand) func() string) {
+	var (
+		mu        sync.Mutex // guards latencies
+		latencies []time.Duration
+		seed      int64
+	)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		mu.Lock()
+		seed++
+		next := keygen(rand.New(rand.NewSource(seed)))
+		mu.Unlock()
+
+		var local []time.Duration
+		for pb.Next() {
+			start := time.Now()
+			if _, err := m.Get(next()); err != nil {
+				b.Error(err)
+				return
+			}
+			local = append(local, time.Since(start))
+		}
+
+		mu.Lock()
+		latencies = append(latencies, local...)
+		mu.Unlock()
+	})
+	b.StopTimer()
+
+	if len(latencies) == 0 {
+		return
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p float64) float64 {
+		return float64(latencies[int(p*float64(len(latencies)-1))].Nanoseconds())
+	}
+	b.ReportMetric(percentile(0.50), "p50-ns")
+	b.ReportMetric(percentile(0.99), "p99-ns")
+}
@@ -5,8 +5,8 @@ package memotest
 import (
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"net/http/httptest"
 	"sync"
 	"testing"
 	"time"
@@ -22,25 +22,101 @@ func httpGetBody(url string) (interface{}, error) {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get %s: %s", url, resp.Status)
+	}
 	return ioutil.ReadAll(resp.Body)
 }
 
 var HTTPGetBody = httpGetBody
 
-func incomingURLs() <-chan string {
+// Server is an in-process HTTP server standing in for the sites
+// the examples used to fetch, so that the tests run offline.
+// It serves a fixed set of pages, delays every response by a
+// configurable latency, can be told to fail chosen paths, and
+// counts the requests made for each path.
+type Server struct {
+	*httptest.Server
+	latency time.Duration
+
+	mu    sync.Mutex     // guards calls and fail
+	calls map[string]int // requests received, by path
+	fail  map[string]int // status to respond with, by path
+}
+
+// pages are the paths served by a Server.
+var pages = []string{"/golang", "/godoc", "/play", "/gopl"}
+
+// NewServer starts a Server whose responses each take latency.
+// Clients must subsequently call Close.
+func NewServer(latency time.Duration) *Server {
+	s := &Server{
+		latency: latency,
+		calls:   make(map[string]int),
+		fail:    make(map[string]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *Server) handle(w http.ResponseWriter, req *http.Request) {
+	path := req.URL.Path
+	s.mu.Lock()
+	s.calls[path]++
+	status := s.fail[path]
+	s.mu.Unlock()
+
+	time.Sleep(s.latency)
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if body, ok := Body(path); ok {
+		fmt.Fprint(w, body)
+		return
+	}
+	http.NotFound(w, req)
+}
+
+// Body returns the content served for path.
+func Body(path string) (string, bool) {
+	for _, p := range pages {
+		if p == path {
+			return "content of " + path, true
+		}
+	}
+	return "", false
+}
+
+// Fail makes subsequent requests for path respond with status.
+func (s *Server) Fail(path string, status int) {
+	s.mu.Lock()
+	s.fail[path] = status
+	s.mu.Unlock()
+}
+
+// Calls returns the number of requests received for path.
+func (s *Server) Calls(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[path]
+}
+
+func (s *Server) failing(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fail[path] != 0
+}
+
+// incomingURLs yields the URL of each page on s, every one
+// repeated n times, as if several clients wanted the same pages.
+func incomingURLs(s *Server, n int) <-chan string {
 	ch := make(chan string)
 	go func() {
-		for _, url := range []string{
-			"https://golang.org",
-			"https://godoc.org",
-			"https://play.golang.org",
-			"http://gopl.io",
-			"https://golang.org",
-			"https://godoc.org",
-			"https://play.golang.org",
-			"http://gopl.io",
-		} {
-			ch <- url
+		for i := 0; i < n; i++ {
+			for _, path := range pages {
+				ch <- s.URL + path
+			}
 		}
 		close(ch)
 	}()
@@ -51,34 +127,63 @@ type M interface {
 	Get(key string) (interface{}, error)
 }
 
-func Sequential(t *testing.T, m M) {
-	for url := range incomingURLs() {
+// Sequential gets every page of s twice, one after the other,
+// and checks the results and that each page was fetched once.
+func Sequential(t *testing.T, m M, s *Server) {
+	for url := range incomingURLs(s, 2) {
 		start := time.Now()
-		val, err := m.Get(url)
-		if err != nil {
-			log.Print(err)
-			continue
-		}
-		fmt.Printf("%s, %s, %d bytes\n",
-			url, time.Since(start), len(value.([]byte)))
+		value, err := m.Get(url)
+		check(t, s, url, value, err)
+		t.Logf("%s, %s", url, time.Since(start))
 	}
+	checkCalls(t, s)
 }
 
-func Concurrent(t *testing.T, m M) {
+// Concurrent gets every page of s many times from concurrent
+// goroutines and checks that, despite the overlapping requests,
+// each page was fetched exactly once.
+func Concurrent(t *testing.T, m M, s *Server) {
 	var n sync.WaitGroup
-	for url := range incomingURLs() {
+	for url := range incomingURLs(s, 8) {
 		n.Add(1)
 		go func(url string) {
 			defer n.Done()
 			start := time.Now()
 			value, err := m.Get(url)
-			if err != nil {
-				log.Print(err)
-				return
-			}
-			fmt.Printf("%s, %s, %d bytes\n",
-				url, time.Since(start), len(value.([]byte)))
+			check(t, s, url, value, err)
+			t.Logf("%s, %s", url, time.Since(start))
 		}(url)
 	}
 	n.Wait()
+	checkCalls(t, s)
+}
+
+// check reports whether the result of getting url from s is
+// the page's content, or an error if the page was made to fail.
+func check(t *testing.T, s *Server, url string, value interface{}, err error) {
+	path := url[len(s.URL):]
+	if s.failing(path) {
+		if err == nil {
+			t.Errorf("Get(%s) succeeded, want error", url)
+		}
+		return
+	}
+	if err != nil {
+		t.Errorf("Get(%s): %v", url, err)
+		return
+	}
+	want, _ := Body(path)
+	if got := string(value.([]byte)); got != want {
+		t.Errorf("Get(%s) = %q, want %q", url, got, want)
+	}
+}
+
+// checkCalls reports every page of s that was not fetched exactly
+// once. Failures are memoized too, so failing pages count as well.
+func checkCalls(t *testing.T, s *Server) {
+	for _, path := range pages {
+		if n := s.Calls(path); n != 1 {
+			t.Errorf("%s fetched %d times, want 1", path, n)
+		}
+	}
 }